@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/newm4n/Adverter/server/web"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ChunkBatch downloads several chunks of the file at path in a single request, each of them verified
+// against its hash. The chunks are returned by chunk number.
+func (c *Client) ChunkBatch(ctx context.Context, path string, chunkNos []int) (map[int][]byte, error) {
+	var chunks map[int][]byte
+	err := c.retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+			c.BaseURL+pathURL(path, "chunk/batch")+"?chunks="+url.QueryEscape(chunkList(chunkNos)), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", web.ChunkBatchContentType)
+		body, err := c.do(req)
+		if err != nil {
+			return err
+		}
+		chunks, err = readChunkBatch(body, path)
+		if err != nil {
+			return err
+		}
+		for _, chunkNo := range chunkNos {
+			if _, ok := chunks[chunkNo]; !ok {
+				return fmt.Errorf("chunk %d of %s missing from the batch. %w", chunkNo, path, io.ErrUnexpectedEOF)
+			}
+		}
+		return nil
+	})
+	return chunks, err
+}
+
+// readChunkBatch reads a web.ChunkBatchContentType stream
+func readChunkBatch(body []byte, path string) (map[int][]byte, error) {
+	chunks := make(map[int][]byte)
+	for len(body) > 0 {
+		if len(body) < web.ChunkBatchFrameSize {
+			return nil, fmt.Errorf("truncated batch of %s. %w", path, io.ErrUnexpectedEOF)
+		}
+		chunkNo := int(binary.BigEndian.Uint32(body[0:4]))
+		hash := hex.EncodeToString(body[4:20])
+		size := int(binary.BigEndian.Uint32(body[20:24]))
+		body = body[web.ChunkBatchFrameSize:]
+		if len(body) < size {
+			return nil, fmt.Errorf("truncated chunk %d of %s. %w", chunkNo, path, io.ErrUnexpectedEOF)
+		}
+		data := body[:size]
+		body = body[size:]
+		if md5Hex(data) != hash {
+			return nil, fmt.Errorf("chunk %d of %s. %w", chunkNo, path, ErrChunkHashMismatch)
+		}
+		chunks[chunkNo] = data
+	}
+	return chunks, nil
+}
+
+// chunkList writes chunk numbers the way the batch endpoint reads them, consecutive numbers as a range
+func chunkList(chunkNos []int) string {
+	items := make([]string, 0)
+	for i := 0; i < len(chunkNos); {
+		j := i
+		for j+1 < len(chunkNos) && chunkNos[j+1] == chunkNos[j]+1 {
+			j++
+		}
+		if j == i {
+			items = append(items, strconv.Itoa(chunkNos[i]))
+		} else {
+			items = append(items, strconv.Itoa(chunkNos[i])+"-"+strconv.Itoa(chunkNos[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// truncatingWriter drops everything written past limit
+type truncatingWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (tw *truncatingWriter) Write(p []byte) (int, error) {
+	if len(p) > tw.limit {
+		p = p[:tw.limit]
+	}
+	tw.limit -= len(p)
+	return tw.ResponseWriter.Write(p)
+}
+
+func TestChunkBatch(t *testing.T) {
+	var batches int32
+	c, root, content := newTestServer(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, "/chunk/batch") {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if atomic.AddInt32(&batches, 1) == 1 {
+				h.ServeHTTP(&truncatingWriter{ResponseWriter: w, limit: 1000}, r)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+	ctx := context.Background()
+	path := filepath.Join(root, "intro.mp4")
+
+	chunks, err := c.ChunkBatch(ctx, path, []int{0, 1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), batches)
+	assert.Equal(t, content, append(append(append([]byte{}, chunks[0]...), chunks[1]...), chunks[2]...))
+
+	_, err = c.ChunkBatch(ctx, path, []int{3})
+	var statusErr *StatusError
+	assert.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+
+	assert.Equal(t, "0-2,5,7-8", chunkList([]int{0, 1, 2, 5, 7, 8}))
+}
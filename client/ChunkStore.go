@@ -0,0 +1,220 @@
+package client
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/newm4n/Adverter/server/web"
+	"github.com/newm4n/Adverter/server/web/model"
+	"os"
+	"path/filepath"
+)
+
+// ChunkStore keeps chunks on the local disk, one file per chunk named after its hash, so a chunk shared
+// by several files, or by several versions of a file, is only downloaded once
+type ChunkStore struct {
+	Dir string
+}
+
+// NewChunkStore opens the chunk store in dir, creating dir if needed
+func NewChunkStore(dir string) (*ChunkStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &ChunkStore{Dir: dir}, nil
+}
+
+// validHash accepts exactly 32 lowercase hex characters, the MD5 chunks are named after. Hashes come from
+// the server, they must never lead outside of the store.
+func validHash(hash string) error {
+	if len(hash) != 2*md5.Size {
+		return fmt.Errorf("%q. %w", hash, ErrInvalidChunkHash)
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return fmt.Errorf("%q. %w", hash, ErrInvalidChunkHash)
+		}
+	}
+	return nil
+}
+
+func (store *ChunkStore) path(hash string) (string, error) {
+	if err := validHash(hash); err != nil {
+		return "", err
+	}
+	return filepath.Join(store.Dir, hash[:2], hash), nil
+}
+
+// Has tells whether the store holds the chunk with the specified hash. It never holds an invalid hash.
+func (store *ChunkStore) Has(hash string) bool {
+	path, err := store.path(hash)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Get reads the chunk with the specified hash. A chunk no longer matching its hash is dropped
+// and reported as missing. An invalid hash is reported as missing, leaving the disk untouched.
+func (store *ChunkStore) Get(hash string) ([]byte, bool) {
+	path, err := store.path(hash)
+	if err != nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	if md5Hex(data) != hash {
+		_ = os.Remove(path)
+		return nil, false
+	}
+	return data, true
+}
+
+// Put stores a chunk under its hash
+func (store *ChunkStore) Put(data []byte) (string, error) {
+	hash := md5Hex(data)
+	path, err := store.path(hash)
+	if err != nil {
+		return hash, err
+	}
+	if store.Has(hash) {
+		return hash, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return hash, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".*")
+	if err != nil {
+		return hash, err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return hash, err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return hash, err
+	}
+	return hash, os.Rename(tmp.Name(), path)
+}
+
+// ChunkByHash downloads the chunk with the specified hash from whichever file of the server holds it
+func (c *Client) ChunkByHash(ctx context.Context, hash string) ([]byte, error) {
+	if err := validHash(hash); err != nil {
+		return nil, err
+	}
+	var data []byte
+	err := c.retry(ctx, func() error {
+		chunk := &web.ChunkInfoRespond{}
+		if err := c.getJSONOnce(ctx, "/chunks/"+hash, chunk); err != nil {
+			return err
+		}
+		decoded, err := base64.StdEncoding.DecodeString(chunk.Base64)
+		if err != nil {
+			return err
+		}
+		if md5Hex(decoded) != hash {
+			return fmt.Errorf("chunk %s. %w", hash, ErrChunkHashMismatch)
+		}
+		data = decoded
+		return nil
+	})
+	return data, err
+}
+
+// StoreFile brings localPath up to date with the file at path through the client's Store. The file is cut
+// into content defined chunks and only the chunks missing from the store are downloaded, by hash. The chunks
+// of the local version of the file are added to the store first.
+func (c *Client) StoreFile(ctx context.Context, path, localPath string) (*UpdateResult, error) {
+	result := &UpdateResult{}
+	manifest, err := c.ManifestChunked(ctx, path, string(model.ChunkingCDC))
+	if err != nil {
+		return result, err
+	}
+	for _, chunk := range manifest.Chunks {
+		if err := validHash(chunk.Hash); err != nil {
+			return result, fmt.Errorf("manifest of %s. got %w", path, err)
+		}
+	}
+	local, err := os.Stat(localPath)
+	result.Existed = err == nil && !local.IsDir()
+	if result.Existed && local.Size() == manifest.Size {
+		if hash, err := md5OfFile(localPath); err == nil && hash == manifest.FileHash {
+			result.Unchanged = true
+			return result, nil
+		}
+	}
+	if result.Existed {
+		if err := c.storeLocal(localPath, manifest); err != nil {
+			return result, err
+		}
+	}
+
+	partPath := localPath + PartSuffix
+	part, err := os.Create(partPath)
+	if err != nil {
+		return result, err
+	}
+	defer part.Close()
+	h := md5.New()
+	for _, chunk := range manifest.Chunks {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		data, ok := c.Store.Get(chunk.Hash)
+		if ok {
+			result.ChunksReused++
+		} else {
+			if data, err = c.ChunkByHash(ctx, chunk.Hash); err != nil {
+				return result, err
+			}
+			if _, err := c.Store.Put(data); err != nil {
+				return result, err
+			}
+			result.ChunksDownloaded++
+			result.BytesDownloaded += int64(len(data))
+		}
+		if _, err := part.WriteAt(data, chunk.Offset); err != nil {
+			return result, err
+		}
+		h.Write(data)
+	}
+	if hex.EncodeToString(h.Sum(nil)) != manifest.FileHash {
+		part.Close()
+		_ = os.Remove(partPath)
+		return result, fmt.Errorf("%s. %w", path, ErrFileHashMismatch)
+	}
+	if err := part.Close(); err != nil {
+		return result, err
+	}
+	return result, os.Rename(partPath, localPath)
+}
+
+// storeLocal adds the chunks of localPath wanted by manifest to the store
+func (c *Client) storeLocal(localPath string, manifest *web.ChunkManifestRespond) error {
+	wanted := make(map[string]bool, len(manifest.Chunks))
+	for _, chunk := range manifest.Chunks {
+		wanted[chunk.Hash] = true
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var putErr error
+	err = model.ChunkContent(f, func(chunk []byte) {
+		if putErr == nil && wanted[md5Hex(chunk)] {
+			_, putErr = c.Store.Put(chunk)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return putErr
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/web"
+	"github.com/newm4n/Adverter/server/web/model"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreFile(t *testing.T) {
+	root := t.TempDir()
+	intro := make([]byte, 600*1024)
+	rand.New(rand.NewSource(4)).Read(intro)
+	outro := make([]byte, 100*1024)
+	rand.New(rand.NewSource(5)).Read(outro)
+	spotA := append(append([]byte{}, intro...), outro...)
+	spotB := append(append(append([]byte{}, intro...), []byte("spot b")...), outro...)
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "a.mp4"), spotA, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "b.mp4"), spotB, 0644))
+
+	model.Chunks = model.NewChunkIndex(model.ChunkingCDC)
+	defer func() { model.Chunks = nil }()
+	router := mux.NewRouter()
+	router.HandleFunc("/path/{b64path}/chunk/manifest", web.GetChunkManifest).Methods(http.MethodGet)
+	router.HandleFunc("/chunks/{hash}", web.GetChunkByHash).Methods(http.MethodGet)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	c := New(server.URL)
+	store, err := NewChunkStore(filepath.Join(t.TempDir(), "store"))
+	assert.NoError(t, err)
+	c.Store = store
+	ctx := context.Background()
+	local := t.TempDir()
+
+	resultA, err := c.UpdateFile(ctx, filepath.Join(root, "a.mp4"), filepath.Join(local, "a.mp4"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, resultA.ChunksReused)
+	downloaded, err := os.ReadFile(filepath.Join(local, "a.mp4"))
+	assert.NoError(t, err)
+	assert.Equal(t, spotA, downloaded)
+
+	resultB, err := c.UpdateFile(ctx, filepath.Join(root, "b.mp4"), filepath.Join(local, "b.mp4"))
+	assert.NoError(t, err)
+	assert.Greater(t, resultB.ChunksReused, 0)
+	assert.Less(t, resultB.BytesDownloaded, int64(len(spotB)/2))
+	downloaded, err = os.ReadFile(filepath.Join(local, "b.mp4"))
+	assert.NoError(t, err)
+	assert.Equal(t, spotB, downloaded)
+
+	_, err = c.ChunkByHash(ctx, md5Hex([]byte("unknown")))
+	var statusErr *StatusError
+	assert.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+}
+
+func TestChunkStoreTraversalHash(t *testing.T) {
+	base := t.TempDir()
+	victim := filepath.Join(base, "victim.txt")
+	assert.NoError(t, os.WriteFile(victim, []byte("victim"), 0644))
+	store, err := NewChunkStore(filepath.Join(base, "a", "store"))
+	assert.NoError(t, err)
+
+	for _, hash := range []string{"../victim.txt", "../../victim.txt", "..", "", md5Hex([]byte("x"))[:31] + "G"} {
+		assert.False(t, store.Has(hash), hash)
+		_, ok := store.Get(hash)
+		assert.False(t, ok, hash)
+	}
+	_, err = os.Stat(victim)
+	assert.NoError(t, err)
+
+	hostile := "../../victim.txt"
+	router := mux.NewRouter()
+	router.HandleFunc("/path/{b64path}/chunk/manifest", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&web.ChunkManifestRespond{Size: 6, FileHash: md5Hex([]byte("victim")),
+			Chunks: []*web.ChunkRespond{{Index: 0, Offset: 0, Size: 6, Hash: hostile}}})
+	}).Methods(http.MethodGet)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	c := New(server.URL)
+	c.Store = store
+	local := filepath.Join(t.TempDir(), "spot.mp4")
+	assert.NoError(t, os.WriteFile(local, []byte("spot"), 0644))
+
+	_, err = c.StoreFile(context.Background(), "/spot.mp4", local)
+	assert.ErrorIs(t, err, ErrInvalidChunkHash)
+	_, err = c.ChunkByHash(context.Background(), hostile)
+	assert.ErrorIs(t, err, ErrInvalidChunkHash)
+	_, err = os.Stat(victim)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,312 @@
+package client
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/newm4n/Adverter/server/web"
+	"github.com/newm4n/Adverter/server/web/model"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrChunkHashMismatch is returned when a downloaded chunk does not match the hash sent along with it
+	ErrChunkHashMismatch = errors.New("chunk hash mismatch")
+	// ErrFileHashMismatch is returned when a downloaded file does not match FileInfoRespond.FileHash
+	ErrFileHashMismatch = errors.New("file hash mismatch")
+	// ErrInvalidChunkHash is returned for a chunk hash that is not an MD5 in lowercase hex, eg. sent by a hostile server
+	ErrInvalidChunkHash = errors.New("invalid chunk hash")
+)
+
+// StatusError is returned when the server answers with an unexpected status
+type StatusError struct {
+	StatusCode int
+	Message    string
+	// Code and RequestID are read from the JSON error body of the server, when it sent one
+	Code      string
+	RequestID string
+	// RetryAfter is how long the server asked to wait before trying again, with 429 and 503
+	RetryAfter time.Duration
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("server responded %d. got %s", err.StatusCode, err.Message)
+}
+
+// Client talks to an Adverter server
+type Client struct {
+	// BaseURL of the server, eg. "http://localhost:51423"
+	BaseURL string
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+	// Token is sent as bearer token when set
+	Token string
+	// Retries is how many times a failed request or a corrupted chunk is tried again
+	Retries int
+	// RetryWait is the pause before the first retry, doubled on every further retry
+	RetryWait time.Duration
+	// Workers is the number of chunks DownloadFile fetches concurrently
+	Workers int
+	// Delta is how UpdateFile and Sync find the chunks a local file already holds
+	Delta DeltaMode
+	// Batch is the number of chunks Download fetches per request, one at a time when below 2
+	Batch int
+	// Store, when set, makes UpdateFile and Sync download each distinct chunk only once, see StoreFile
+	Store *ChunkStore
+}
+
+// New creates a client of the server at baseURL, retrying 3 times and downloading 4 chunks at once
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:   strings.TrimSuffix(baseURL, "/"),
+		Retries:   3,
+		RetryWait: 500 * time.Millisecond,
+		Workers:   4,
+		Batch:     16,
+	}
+}
+
+// Roots lists the top directories served by the server
+func (c *Client) Roots(ctx context.Context) ([]*web.DirItemRespond, error) {
+	ret := make([]*web.DirItemRespond, 0)
+	return ret, c.getJSON(ctx, "/roots", &ret)
+}
+
+// ListDirectories lists the directories inside path
+func (c *Client) ListDirectories(ctx context.Context, path string) ([]*web.DirItemRespond, error) {
+	ret := make([]*web.DirItemRespond, 0)
+	return ret, c.getJSON(ctx, pathURL(path, "directories"), &ret)
+}
+
+// ListFiles lists the files inside path
+func (c *Client) ListFiles(ctx context.Context, path string) ([]*web.DirItemRespond, error) {
+	ret := make([]*web.DirItemRespond, 0)
+	return ret, c.getJSON(ctx, pathURL(path, "files"), &ret)
+}
+
+// FileInfo fetches the chunk layout and hash of the file at path
+func (c *Client) FileInfo(ctx context.Context, path string) (*web.FileInfoRespond, error) {
+	ret := &web.FileInfoRespond{}
+	return ret, c.getJSON(ctx, pathURL(path, "chunk/info"), ret)
+}
+
+// Manifest fetches the hash of every chunk of the file at path
+func (c *Client) Manifest(ctx context.Context, path string) (*web.ChunkManifestRespond, error) {
+	return c.ManifestChunked(ctx, path, "")
+}
+
+// ManifestChunked fetches the hash of every chunk of the file at path, cut the chunking way, fixed or cdc
+func (c *Client) ManifestChunked(ctx context.Context, path, chunking string) (*web.ChunkManifestRespond, error) {
+	uri := pathURL(path, "chunk/manifest")
+	if len(chunking) > 0 {
+		uri += "?chunking=" + url.QueryEscape(chunking)
+	}
+	ret := &web.ChunkManifestRespond{}
+	return ret, c.getJSON(ctx, uri, ret)
+}
+
+// Chunk downloads chunk number chunkNo of the file at path, verified against its hash
+func (c *Client) Chunk(ctx context.Context, path string, chunkNo int) ([]byte, error) {
+	var data []byte
+	err := c.retry(ctx, func() error {
+		chunk := &web.ChunkInfoRespond{}
+		if err := c.getJSONOnce(ctx, pathURL(path, fmt.Sprintf("chunk/%d", chunkNo)), chunk); err != nil {
+			return err
+		}
+		decoded, err := base64.StdEncoding.DecodeString(chunk.Base64)
+		if err != nil {
+			return err
+		}
+		if md5Hex(decoded) != chunk.Hash {
+			return fmt.Errorf("chunk %d of %s. %w", chunkNo, path, ErrChunkHashMismatch)
+		}
+		data = decoded
+		return nil
+	})
+	return data, err
+}
+
+// Download downloads the file at path into w, chunk after chunk, verifying every chunk and the whole file
+func (c *Client) Download(ctx context.Context, path string, w io.WriterAt) (*web.FileInfoRespond, error) {
+	info, err := c.FileInfo(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	h := md5.New()
+	offset := int64(0)
+	batch := c.Batch
+	if batch < 1 {
+		batch = 1
+	}
+	for first := 0; first < info.ChunkCount; first += batch {
+		chunkNos := make([]int, 0, batch)
+		for chunkNo := first; chunkNo < first+batch && chunkNo < info.ChunkCount; chunkNo++ {
+			chunkNos = append(chunkNos, chunkNo)
+		}
+		chunks := make(map[int][]byte, len(chunkNos))
+		if len(chunkNos) == 1 {
+			data, err := c.Chunk(ctx, path, first)
+			if err != nil {
+				return info, err
+			}
+			chunks[first] = data
+		} else if chunks, err = c.ChunkBatch(ctx, path, chunkNos); err != nil {
+			return info, err
+		}
+		for _, chunkNo := range chunkNos {
+			if _, err := w.WriteAt(chunks[chunkNo], offset); err != nil {
+				return info, err
+			}
+			h.Write(chunks[chunkNo])
+			offset += int64(len(chunks[chunkNo]))
+		}
+	}
+	if hex.EncodeToString(h.Sum(nil)) != info.FileHash {
+		return info, fmt.Errorf("%s. %w", path, ErrFileHashMismatch)
+	}
+	return info, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, uri string, v interface{}) error {
+	return c.retry(ctx, func() error {
+		return c.getJSONOnce(ctx, uri, v)
+	})
+}
+
+func (c *Client) getJSONOnce(ctx context.Context, uri string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+uri, nil)
+	if err != nil {
+		return err
+	}
+	return c.doJSON(req, v)
+}
+
+// doJSON sends req and decodes the JSON response into v
+func (c *Client) doJSON(req *http.Request, v interface{}) error {
+	body, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// do sends req and reads the body of its response, a StatusError unless the server answered 200
+func (c *Client) do(req *http.Request) ([]byte, error) {
+	if len(c.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		statusErr := &StatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+		envelope := &struct {
+			Code      string `json:"code"`
+			Message   string `json:"message"`
+			Details   string `json:"details"`
+			RequestID string `json:"requestId"`
+		}{}
+		if json.Unmarshal(body, envelope) == nil && len(envelope.Code) > 0 {
+			statusErr.Code, statusErr.RequestID, statusErr.Message = envelope.Code, envelope.RequestID, envelope.Message
+			if len(envelope.Details) > 0 {
+				statusErr.Message += ". " + envelope.Details
+			}
+		}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			statusErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, statusErr
+	}
+	return body, nil
+}
+
+// readBody reads the body of resp, decompressing it as told by its Content-Encoding
+func readBody(resp *http.Response) ([]byte, error) {
+	var reader io.Reader = resp.Body
+	switch resp.Header.Get("Content-Encoding") {
+	case "gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	case "deflate":
+		fl := flate.NewReader(resp.Body)
+		defer fl.Close()
+		reader = fl
+	}
+	return io.ReadAll(reader)
+}
+
+// retry calls fn until it succeeds, fails for good or the retries are exhausted
+func (c *Client) retry(ctx context.Context, fn func() error) error {
+	wait := c.RetryWait
+	var err error
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if attempt > 0 {
+			pause := wait
+			var statusErr *StatusError
+			if errors.As(err, &statusErr) && statusErr.RetryAfter > pause {
+				pause = statusErr.RetryAfter
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(pause):
+			}
+			wait *= 2
+		}
+		if err = fn(); err == nil || !retryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// retryable tells whether trying again may help: network failures, server errors and corrupted chunks
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	var syntaxErr *json.SyntaxError
+	return !errors.As(err, &syntaxErr)
+}
+
+func pathURL(path, endpoint string) string {
+	pi := &model.PathInfo{
+		Path: path,
+	}
+	return fmt.Sprintf("/path/%s/%s", pi.ToPathInfoString(), endpoint)
+}
+
+func md5Hex(data []byte) string {
+	h := md5.Sum(data)
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/web"
+	"github.com/newm4n/Adverter/server/web/model"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T, handler func(http.Handler) http.Handler) (*Client, string, []byte) {
+	root := t.TempDir()
+	content := make([]byte, 2*model.DefaultChunkSize+1234)
+	rand.New(rand.NewSource(1)).Read(content)
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "summer"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "intro.mp4"), content, 0644))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/path/{b64path}/files", web.ListFiles).Methods(http.MethodGet)
+	router.HandleFunc("/path/{b64path}/directories", web.ListDirectories).Methods(http.MethodGet)
+	router.HandleFunc("/path/{b64path}/chunk/info", web.GetChunkInfo).Methods(http.MethodGet)
+	router.HandleFunc("/path/{b64path}/chunk/manifest", web.GetChunkManifest).Methods(http.MethodGet)
+	router.HandleFunc("/path/{b64path}/chunk/delta", web.GetChunkDelta).Methods(http.MethodPost)
+	router.HandleFunc("/path/{b64path}/chunk/batch", web.Compressed(web.GetChunkBatch)).Methods(http.MethodGet)
+	router.HandleFunc("/path/{b64path}/chunk/{chunkno}", web.GetChunkData).Methods(http.MethodGet)
+	server := httptest.NewServer(handler(router))
+	t.Cleanup(server.Close)
+
+	c := New(server.URL)
+	c.RetryWait = time.Millisecond
+	return c, root, content
+}
+
+func TestDownload(t *testing.T) {
+	c, root, content := newTestServer(t, func(h http.Handler) http.Handler { return h })
+	ctx := context.Background()
+
+	files, err := c.ListFiles(ctx, root)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	dirs, err := c.ListDirectories(ctx, root)
+	assert.NoError(t, err)
+	assert.Len(t, dirs, 1)
+
+	info, err := c.FileInfo(ctx, files[0].Path)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, info.ChunkCount)
+	assert.Equal(t, int64(len(content)), info.Size)
+
+	out, err := os.Create(filepath.Join(t.TempDir(), "intro.mp4"))
+	assert.NoError(t, err)
+	defer out.Close()
+	_, err = c.Download(ctx, files[0].Path, out)
+	assert.NoError(t, err)
+	downloaded, err := os.ReadFile(out.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, md5Hex(content), md5Hex(downloaded))
+
+	_, err = c.FileInfo(ctx, filepath.Join(root, "missing.mp4"))
+	var statusErr *StatusError
+	assert.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+	assert.Equal(t, "NOT_FOUND", statusErr.Code)
+}
+
+func TestDownloadRetries(t *testing.T) {
+	var calls int32
+	c, root, content := newTestServer(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, "/chunk/1") {
+				h.ServeHTTP(w, r)
+				return
+			}
+			switch atomic.AddInt32(&calls, 1) {
+			case 1:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			case 2:
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"Base64":"AAAA","Hash":"` + hex.EncodeToString(make([]byte, md5.Size)) + `"}`))
+			default:
+				h.ServeHTTP(w, r)
+			}
+		})
+	})
+
+	c.Batch = 1
+	out, err := os.Create(filepath.Join(t.TempDir(), "intro.mp4"))
+	assert.NoError(t, err)
+	defer out.Close()
+	_, err = c.Download(context.Background(), filepath.Join(root, "intro.mp4"), out)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), calls)
+	downloaded, err := os.ReadFile(out.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, content, downloaded)
+
+	c.Retries = 0
+	atomic.StoreInt32(&calls, 0)
+	_, err = c.Download(context.Background(), filepath.Join(root, "intro.mp4"), out)
+	assert.Error(t, err)
+}
@@ -0,0 +1,269 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/newm4n/Adverter/server/web"
+	"github.com/newm4n/Adverter/server/web/model"
+	"io"
+	"net/http"
+	"os"
+)
+
+// DeltaMode selects how the chunks of a local file are matched with the chunks of its updated version
+type DeltaMode int
+
+const (
+	// DeltaFixed reuses the local chunks still holding the same content at the same offset,
+	// asking the server which chunks changed
+	DeltaFixed DeltaMode = iota
+	// DeltaRolling searches the local file at every offset for the chunks of the updated version,
+	// rsync style, so content shifted by an insertion is reused as well
+	DeltaRolling
+)
+
+// UpdateResult tells how a file was brought up to date by UpdateFile
+type UpdateResult struct {
+	Existed          bool
+	Unchanged        bool
+	ChunksReused     int
+	ChunksDownloaded int
+	BytesDownloaded  int64
+}
+
+// ChangedChunks sends the hashes of the local chunks of a file to the server, which answers
+// the indexes of the chunks of the file at path that differ
+func (c *Client) ChangedChunks(ctx context.Context, path string, hashes []string) (*web.ChunkDeltaRespond, error) {
+	body, err := json.Marshal(&web.ChunkDeltaRequest{Hashes: hashes})
+	if err != nil {
+		return nil, err
+	}
+	ret := &web.ChunkDeltaRespond{}
+	err = c.retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+pathURL(path, "chunk/delta"), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return c.doJSON(req, ret)
+	})
+	return ret, err
+}
+
+// UpdateFile brings localPath up to date with the file at path, only downloading the chunks
+// the local version does not already hold, as found with the client's DeltaMode.
+// With a Store, the file is updated with StoreFile instead.
+func (c *Client) UpdateFile(ctx context.Context, path, localPath string) (*UpdateResult, error) {
+	if c.Store != nil {
+		return c.StoreFile(ctx, path, localPath)
+	}
+	result := &UpdateResult{}
+	manifest, err := c.Manifest(ctx, path)
+	if err != nil {
+		return result, err
+	}
+	local, err := os.Stat(localPath)
+	result.Existed = err == nil && !local.IsDir()
+	if result.Existed && local.Size() == manifest.Size {
+		if hash, err := md5OfFile(localPath); err == nil && hash == manifest.FileHash {
+			result.Unchanged = true
+			return result, nil
+		}
+	}
+
+	info := fileInfoOf(manifest)
+	statePath := localPath + StateSuffix
+	if result.Existed && loadState(statePath, info) == nil {
+		var matches map[int]int64
+		if c.Delta == DeltaRolling {
+			matches, err = rollingMatches(localPath, manifest)
+		} else {
+			matches, err = c.fixedMatches(ctx, path, localPath, manifest)
+		}
+		if err != nil {
+			return result, err
+		}
+		if err := seedFromLocal(localPath, manifest, matches); err != nil {
+			return result, err
+		}
+	}
+	reused := make(map[int]bool)
+	if state := loadState(statePath, info); state != nil {
+		for _, chunkNo := range state.Verified {
+			reused[chunkNo] = true
+		}
+	}
+
+	if _, err := c.DownloadFile(ctx, path, localPath); err != nil {
+		return result, err
+	}
+	for _, chunk := range manifest.Chunks {
+		if reused[chunk.Index] {
+			result.ChunksReused++
+		} else {
+			result.ChunksDownloaded++
+			result.BytesDownloaded += int64(chunk.Size)
+		}
+	}
+	return result, nil
+}
+
+// fixedMatches hashes the local file in chunks of the server's chunk size and lets the server tell
+// which of them are still valid, at the same offset
+func (c *Client) fixedMatches(ctx context.Context, path, localPath string, manifest *web.ChunkManifestRespond) (map[int]int64, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hashes := make([]string, 0)
+	buf := make([]byte, manifest.ChunkSize)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			hashes = append(hashes, md5Hex(buf[:n]))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	delta, err := c.ChangedChunks(ctx, path, hashes)
+	if err != nil {
+		return nil, err
+	}
+	changed := make(map[int]bool, len(delta.Changed))
+	for _, chunkNo := range delta.Changed {
+		changed[chunkNo] = true
+	}
+	matches := make(map[int]int64)
+	for _, chunk := range manifest.Chunks {
+		if !changed[chunk.Index] {
+			matches[chunk.Index] = chunk.Offset
+		}
+	}
+	return matches, nil
+}
+
+// rollingMatches slides a window over the local file, one byte at a time, looking up the rolling
+// checksum of the window among the chunks of the manifest. Candidates are confirmed with their MD5.
+func rollingMatches(localPath string, manifest *web.ChunkManifestRespond) (map[int]int64, error) {
+	bySize := make(map[int]map[uint32][]*web.ChunkRespond)
+	for _, chunk := range manifest.Chunks {
+		if bySize[chunk.Size] == nil {
+			bySize[chunk.Size] = make(map[uint32][]*web.ChunkRespond)
+		}
+		bySize[chunk.Size][chunk.Weak] = append(bySize[chunk.Size][chunk.Weak], chunk)
+	}
+	matches := make(map[int]int64)
+	for size, wanted := range bySize {
+		if err := rollOver(localPath, size, wanted, matches); err != nil {
+			return nil, err
+		}
+	}
+	return matches, nil
+}
+
+func rollOver(localPath string, size int, wanted map[uint32][]*web.ChunkRespond, matches map[int]int64) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader := bufio.NewReaderSize(f, 1<<20)
+	ring := make([]byte, size)
+	if _, err := io.ReadFull(reader, ring); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// the local file is smaller than the chunks
+			return nil
+		}
+		return err
+	}
+	rolling := model.NewRolling(ring)
+	window := make([]byte, size)
+	head := 0
+	for offset := int64(0); ; offset++ {
+		if candidates, ok := wanted[rolling.Sum()]; ok {
+			copy(window, ring[head:])
+			copy(window[size-head:], ring[:head])
+			hash := ""
+			for _, chunk := range candidates {
+				if _, found := matches[chunk.Index]; found {
+					continue
+				}
+				if len(hash) == 0 {
+					hash = md5Hex(window)
+				}
+				if hash == chunk.Hash {
+					matches[chunk.Index] = offset
+				}
+			}
+		}
+		in, err := reader.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		out := ring[head]
+		ring[head] = in
+		head = (head + 1) % size
+		rolling.Roll(out, in)
+	}
+}
+
+// seedFromLocal prepares the partial file of a download with the chunks found in the local version
+// of the file, matches giving their offset in the local file, and records them as verified so
+// DownloadFile only fetches the others.
+func seedFromLocal(localPath string, manifest *web.ChunkManifestRespond, matches map[int]int64) error {
+	in, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	part, err := os.Create(localPath + PartSuffix)
+	if err != nil {
+		return err
+	}
+	defer part.Close()
+	if err := part.Truncate(manifest.Size); err != nil {
+		return err
+	}
+
+	state := &DownloadState{
+		Path:       manifest.Path,
+		FileHash:   manifest.FileHash,
+		Size:       manifest.Size,
+		ChunkSize:  manifest.ChunkSize,
+		ChunkCount: manifest.ChunkCount,
+		Verified:   make([]int, 0),
+	}
+	buf := make([]byte, manifest.ChunkSize)
+	for _, chunk := range manifest.Chunks {
+		localOffset, ok := matches[chunk.Index]
+		if !ok {
+			continue
+		}
+		n, err := in.ReadAt(buf[:chunk.Size], localOffset)
+		if n < chunk.Size {
+			return fmt.Errorf("can not read chunk %d at %d of %s. got %v", chunk.Index, localOffset, localPath, err)
+		}
+		if md5Hex(buf[:n]) != chunk.Hash {
+			continue
+		}
+		if _, err := part.WriteAt(buf[:n], chunk.Offset); err != nil {
+			return err
+		}
+		state.Verified = append(state.Verified, chunk.Index)
+	}
+	if err := part.Sync(); err != nil {
+		return err
+	}
+	return saveState(localPath+StateSuffix, state)
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateFile(t *testing.T) {
+	c, root, content := newTestServer(t, func(h http.Handler) http.Handler { return h })
+	remotePath := filepath.Join(root, "intro.mp4")
+	inserted := append([]byte("a re-encoded intro, a few bytes longer than before"), content...)
+	assert.NoError(t, os.WriteFile(remotePath, inserted, 0644))
+
+	for mode, expected := range map[DeltaMode]*UpdateResult{
+		DeltaFixed:   {Existed: true, ChunksReused: 0, ChunksDownloaded: 3},
+		DeltaRolling: {Existed: true, ChunksReused: 2, ChunksDownloaded: 1},
+	} {
+		localPath := filepath.Join(t.TempDir(), "intro.mp4")
+		assert.NoError(t, os.WriteFile(localPath, content, 0644))
+		c.Delta = mode
+		result, err := c.UpdateFile(context.Background(), remotePath, localPath)
+		assert.NoError(t, err)
+		assert.Equal(t, expected.ChunksReused, result.ChunksReused)
+		assert.Equal(t, expected.ChunksDownloaded, result.ChunksDownloaded)
+		assert.True(t, result.Existed)
+		data, err := os.ReadFile(localPath)
+		assert.NoError(t, err)
+		assert.Equal(t, inserted, data)
+
+		result, err = c.UpdateFile(context.Background(), remotePath, localPath)
+		assert.NoError(t, err)
+		assert.True(t, result.Unchanged)
+	}
+}
+
+func TestChangedChunks(t *testing.T) {
+	c, root, content := newTestServer(t, func(h http.Handler) http.Handler { return h })
+	manifest, err := c.Manifest(context.Background(), filepath.Join(root, "intro.mp4"))
+	assert.NoError(t, err)
+	assert.Equal(t, md5Hex(content), manifest.FileHash)
+
+	hashes := []string{manifest.Chunks[0].Hash, "changed"}
+	delta, err := c.ChangedChunks(context.Background(), filepath.Join(root, "intro.mp4"), hashes)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, delta.Changed)
+}
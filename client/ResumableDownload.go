@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/newm4n/Adverter/server/web"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// PartSuffix is appended to the local path of a file being downloaded
+	PartSuffix = ".part"
+	// StateSuffix is appended to the local path of a file being downloaded to name its progress state file
+	StateSuffix = ".state"
+)
+
+// DownloadState is the progress of a resumable download, kept next to the partial file
+type DownloadState struct {
+	Path       string
+	FileHash   string
+	Size       int64
+	ChunkSize  int
+	ChunkCount int
+	Verified   []int
+}
+
+// DownloadFile downloads the file at path into localPath with Workers concurrent chunk downloads.
+// Verified chunks are recorded in localPath+StateSuffix so an interrupted download resumes where it
+// stopped. The file is only renamed into localPath once its whole hash matches.
+func (c *Client) DownloadFile(ctx context.Context, path, localPath string) (*web.FileInfoRespond, error) {
+	info, err := c.FileInfo(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if info.ChunkSize <= 0 {
+		return info, fmt.Errorf("server did not tell the chunk size of %s", path)
+	}
+	partPath, statePath := localPath+PartSuffix, localPath+StateSuffix
+
+	state := loadState(statePath, info)
+	if _, err := os.Stat(partPath); err != nil {
+		state = nil
+	}
+	if state == nil {
+		state = &DownloadState{
+			Path:       path,
+			FileHash:   info.FileHash,
+			Size:       info.Size,
+			ChunkSize:  info.ChunkSize,
+			ChunkCount: info.ChunkCount,
+		}
+		_ = os.Remove(partPath)
+	}
+	part, err := os.OpenFile(partPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return info, err
+	}
+	defer part.Close()
+	if err := part.Truncate(info.Size); err != nil {
+		return info, err
+	}
+
+	if err := c.downloadChunks(ctx, info, part, state, statePath); err != nil {
+		return info, err
+	}
+
+	if _, err := part.Seek(0, io.SeekStart); err != nil {
+		return info, err
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, part); err != nil {
+		return info, err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != info.FileHash {
+		// the partial file can not be trusted anymore, start from scratch next time
+		part.Close()
+		_ = os.Remove(partPath)
+		_ = os.Remove(statePath)
+		return info, fmt.Errorf("%s. %w", path, ErrFileHashMismatch)
+	}
+	if err := part.Close(); err != nil {
+		return info, err
+	}
+	if err := os.Rename(partPath, localPath); err != nil {
+		return info, err
+	}
+	_ = os.Remove(statePath)
+	return info, nil
+}
+
+// downloadChunks fetches every chunk not yet verified with Workers workers, saving the state
+// at most every second and when done
+func (c *Client) downloadChunks(ctx context.Context, info *web.FileInfoRespond, part *os.File, state *DownloadState, statePath string) error {
+	verified := make(map[int]bool, len(state.Verified))
+	for _, chunkNo := range state.Verified {
+		verified[chunkNo] = true
+	}
+	todo := make(chan int, info.ChunkCount)
+	for chunkNo := 0; chunkNo < info.ChunkCount; chunkNo++ {
+		if !verified[chunkNo] {
+			todo <- chunkNo
+		}
+	}
+	close(todo)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mutex    sync.Mutex
+		firstErr error
+		lastSave = time.Now()
+		wg       sync.WaitGroup
+	)
+	save := func() error {
+		if err := part.Sync(); err != nil {
+			return err
+		}
+		state.Verified = state.Verified[:0]
+		for chunkNo := range verified {
+			state.Verified = append(state.Verified, chunkNo)
+		}
+		sort.Ints(state.Verified)
+		return saveState(statePath, state)
+	}
+
+	workers := c.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunkNo := range todo {
+				err := c.downloadChunk(ctx, info, part, chunkNo)
+				mutex.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					mutex.Unlock()
+					return
+				}
+				verified[chunkNo] = true
+				if time.Since(lastSave) > time.Second {
+					lastSave = time.Now()
+					if err := save(); err != nil && firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := save(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+func (c *Client) downloadChunk(ctx context.Context, info *web.FileInfoRespond, part *os.File, chunkNo int) error {
+	data, err := c.Chunk(ctx, info.Path, chunkNo)
+	if err != nil {
+		return err
+	}
+	offset := int64(chunkNo) * int64(info.ChunkSize)
+	expected := int64(info.ChunkSize)
+	if offset+expected > info.Size {
+		expected = info.Size - offset
+	}
+	if int64(len(data)) != expected {
+		return fmt.Errorf("chunk %d of %s has %d bytes, expecting %d", chunkNo, info.Path, len(data), expected)
+	}
+	_, err = part.WriteAt(data, offset)
+	return err
+}
+
+// loadState reads the state file of an earlier download of the same file content, nil if there is none
+func loadState(statePath string, info *web.FileInfoRespond) *DownloadState {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil
+	}
+	state := &DownloadState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil
+	}
+	if state.FileHash != info.FileHash || state.Size != info.Size || state.ChunkSize != info.ChunkSize {
+		return nil
+	}
+	return state
+}
+
+func saveState(statePath string, state *DownloadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, statePath)
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"github.com/newm4n/Adverter/server/web"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDownloadFileResumes(t *testing.T) {
+	var failing, chunkCalls int32 = 1, 0
+	c, root, content := newTestServer(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.URL.Path, "/chunk/") && !strings.HasSuffix(r.URL.Path, "/info") {
+				atomic.AddInt32(&chunkCalls, 1)
+				if atomic.LoadInt32(&failing) == 1 && strings.HasSuffix(r.URL.Path, "/chunk/2") {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+	c.Workers = 1
+	localPath := filepath.Join(t.TempDir(), "intro.mp4")
+
+	_, err := c.DownloadFile(context.Background(), filepath.Join(root, "intro.mp4"), localPath)
+	assert.Error(t, err)
+	_, err = os.Stat(localPath)
+	assert.True(t, os.IsNotExist(err))
+	state := loadState(localPath+StateSuffix, mustFileInfo(t, c, filepath.Join(root, "intro.mp4")))
+	assert.NotNil(t, state)
+	assert.Equal(t, []int{0, 1}, state.Verified)
+
+	atomic.StoreInt32(&failing, 0)
+	atomic.StoreInt32(&chunkCalls, 0)
+	c.Workers = 3
+	_, err = c.DownloadFile(context.Background(), filepath.Join(root, "intro.mp4"), localPath)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), chunkCalls)
+
+	downloaded, err := os.ReadFile(localPath)
+	assert.NoError(t, err)
+	assert.Equal(t, content, downloaded)
+	_, err = os.Stat(localPath + StateSuffix)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(localPath + PartSuffix)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadFileParallel(t *testing.T) {
+	c, root, content := newTestServer(t, func(h http.Handler) http.Handler { return h })
+	c.Workers = 8
+	localPath := filepath.Join(t.TempDir(), "intro.mp4")
+	_, err := c.DownloadFile(context.Background(), filepath.Join(root, "intro.mp4"), localPath)
+	assert.NoError(t, err)
+	downloaded, err := os.ReadFile(localPath)
+	assert.NoError(t, err)
+	assert.Equal(t, content, downloaded)
+}
+
+func mustFileInfo(t *testing.T, c *Client, path string) *web.FileInfoRespond {
+	info, err := c.FileInfo(context.Background(), path)
+	assert.NoError(t, err)
+	return info
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/newm4n/Adverter/server/web"
+	"github.com/newm4n/Adverter/server/web/model"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SyncReport summarizes what Sync did
+type SyncReport struct {
+	Files            int
+	Created          int
+	Updated          int
+	Unchanged        int
+	Deleted          int
+	ChunksDownloaded int
+	ChunksReused     int
+	BytesDownloaded  int64
+	Failed           []string
+}
+
+func (report *SyncReport) String() string {
+	return fmt.Sprintf("%d files: %d created, %d updated, %d unchanged, %d deleted, %d failed. "+
+		"%d chunks downloaded (%d bytes), %d chunks reused",
+		report.Files, report.Created, report.Updated, report.Unchanged, report.Deleted, len(report.Failed),
+		report.ChunksDownloaded, report.BytesDownloaded, report.ChunksReused)
+}
+
+// Sync mirrors the remote directory remoteDir into localDir. Files whose hash differs from the
+// remote one are updated with UpdateFile, reusing the chunks the local version already holds.
+// Local files and directories missing remotely are deleted when deleteRemoved is set.
+// A file failing to sync is reported and does not stop the others.
+func (c *Client) Sync(ctx context.Context, remoteDir, localDir string, deleteRemoved bool) (*SyncReport, error) {
+	report := &SyncReport{Failed: make([]string, 0)}
+	if err := c.syncDirectory(ctx, remoteDir, localDir, deleteRemoved, report); err != nil {
+		return report, err
+	}
+	return report, ctx.Err()
+}
+
+func (c *Client) syncDirectory(ctx context.Context, remoteDir, localDir string, deleteRemoved bool, report *SyncReport) error {
+	files, err := c.ListFiles(ctx, remoteDir)
+	if err != nil {
+		return err
+	}
+	dirs, err := c.ListDirectories(ctx, remoteDir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return err
+	}
+
+	remote := make(map[string]bool)
+	for _, f := range files {
+		// names come from the server, they must not lead outside of localDir
+		if err := model.ValidateName(f.Name); err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: %s", f.Path, err.Error()))
+			continue
+		}
+		remote[f.Name] = true
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		report.Files++
+		if err := c.syncFile(ctx, f.Path, filepath.Join(localDir, f.Name), report); err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: %s", f.Path, err.Error()))
+		}
+	}
+	for _, d := range dirs {
+		if err := model.ValidateName(d.Name); err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: %s", d.Path, err.Error()))
+			continue
+		}
+		if remote[d.Name] {
+			// an archive, already synced as a file
+			continue
+		}
+		remote[d.Name] = true
+		if err := c.syncDirectory(ctx, d.Path, filepath.Join(localDir, d.Name), deleteRemoved, report); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: %s", d.Path, err.Error()))
+		}
+	}
+
+	if !deleteRemoved {
+		return nil
+	}
+	entries, err := os.ReadDir(localDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := strings.TrimSuffix(strings.TrimSuffix(e.Name(), StateSuffix), PartSuffix)
+		if remote[name] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(localDir, e.Name())); err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: %s", filepath.Join(localDir, e.Name()), err.Error()))
+			continue
+		}
+		report.Deleted++
+	}
+	return nil
+}
+
+func (c *Client) syncFile(ctx context.Context, remotePath, localPath string, report *SyncReport) error {
+	result, err := c.UpdateFile(ctx, remotePath, localPath)
+	if err != nil {
+		return err
+	}
+	report.ChunksReused += result.ChunksReused
+	report.ChunksDownloaded += result.ChunksDownloaded
+	report.BytesDownloaded += result.BytesDownloaded
+	switch {
+	case result.Unchanged:
+		report.Unchanged++
+	case result.Existed:
+		report.Updated++
+	default:
+		report.Created++
+	}
+	return nil
+}
+
+func fileInfoOf(manifest *web.ChunkManifestRespond) *web.FileInfoRespond {
+	return &web.FileInfoRespond{
+		Name:       manifest.Name,
+		Path:       manifest.Path,
+		ChunkCount: manifest.ChunkCount,
+		ChunkSize:  manifest.ChunkSize,
+		Size:       manifest.Size,
+		FileHash:   manifest.FileHash,
+	}
+}
+
+func md5OfFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
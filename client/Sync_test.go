@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/newm4n/Adverter/server/web"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	c, root, content := newTestServer(t, func(h http.Handler) http.Handler { return h })
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "summer", "banner.jpg"), []byte("banner"), 0644))
+	local := t.TempDir()
+	ctx := context.Background()
+
+	report, err := c.Sync(ctx, root, local, false)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Failed)
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, 4, report.ChunksDownloaded)
+	data, err := os.ReadFile(filepath.Join(local, "summer", "banner.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, "banner", string(data))
+
+	content[len(content)-1]++
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "intro.mp4"), content, 0644))
+	report, err = c.Sync(ctx, root, local, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Updated)
+	assert.Equal(t, 1, report.Unchanged)
+	assert.Equal(t, 1, report.ChunksDownloaded)
+	assert.Equal(t, 2, report.ChunksReused)
+	data, err = os.ReadFile(filepath.Join(local, "intro.mp4"))
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+
+	assert.NoError(t, os.Remove(filepath.Join(root, "summer", "banner.jpg")))
+	assert.NoError(t, os.WriteFile(filepath.Join(local, "stale.txt"), []byte("stale"), 0644))
+	report, err = c.Sync(ctx, root, local, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Deleted)
+	_, err = os.Stat(filepath.Join(local, "stale.txt"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(local, "summer", "banner.jpg"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSyncHostileListing(t *testing.T) {
+	var root string
+	c, root, _ := newTestServer(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			intro := filepath.Join(root, "intro.mp4")
+			switch {
+			case strings.HasSuffix(r.URL.Path, "/files"):
+				json.NewEncoder(w).Encode([]*web.DirItemRespond{
+					{Name: "intro.mp4", Path: intro},
+					{Name: "../escape.mp4", Path: intro},
+					{Name: "..", Path: intro},
+				})
+			case strings.HasSuffix(r.URL.Path, "/directories"):
+				json.NewEncoder(w).Encode([]*web.DirItemRespond{
+					{Name: "..", Path: filepath.Join(root, "summer")},
+					{Name: "summer/../..", Path: filepath.Join(root, "summer")},
+				})
+			default:
+				h.ServeHTTP(w, r)
+			}
+		})
+	})
+	parent := t.TempDir()
+	local := filepath.Join(parent, "mirror")
+
+	report, err := c.Sync(context.Background(), root, local, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Created)
+	assert.Len(t, report.Failed, 4)
+	_, err = os.Stat(filepath.Join(local, "intro.mp4"))
+	assert.NoError(t, err)
+	entries, err := os.ReadDir(parent)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
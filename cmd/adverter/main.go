@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/newm4n/Adverter/client"
+	"github.com/newm4n/Adverter/server/web"
+	"os"
+	"os/signal"
+)
+
+const usage = `usage:
+  adverter serve
+  adverter sync [-server url] [-token token] [-workers n] [-delta fixed|rolling] [-store dir] [-delete] <remote-path> <local-dir>
+`
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "serve" {
+		web.Start()
+		return
+	}
+	switch os.Args[1] {
+	case "sync":
+		os.Exit(runSync(os.Args[2:]))
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func runSync(args []string) int {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	server := flags.String("server", envOr("ADVERTER_SERVER", "http://localhost:3000"), "base URL of the Adverter server")
+	token := flags.String("token", os.Getenv("ADVERTER_TOKEN"), "bearer token sent to the server")
+	workers := flags.Int("workers", 4, "chunks downloaded concurrently")
+	delta := flags.String("delta", "fixed", "how changed files reuse local chunks, fixed or rolling")
+	store := flags.String("store", "", "local chunk store, chunks shared by several files are only downloaded once")
+	deleteRemoved := flags.Bool("delete", false, "delete local files missing on the server")
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	c := client.New(*server)
+	c.Token = *token
+	c.Workers = *workers
+	switch *delta {
+	case "fixed":
+		c.Delta = client.DeltaFixed
+	case "rolling":
+		c.Delta = client.DeltaRolling
+	default:
+		flags.Usage()
+		return 2
+	}
+	if len(*store) > 0 {
+		chunkStore, err := client.NewChunkStore(*store)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		c.Store = chunkStore
+	}
+	report, err := c.Sync(ctx, flags.Arg(0), flags.Arg(1), *deleteRemoved)
+	for _, failure := range report.Failed {
+		fmt.Fprintln(os.Stderr, "failed", failure)
+	}
+	fmt.Println(report.String())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	if len(report.Failed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); len(v) > 0 {
+		return v
+	}
+	return def
+}
@@ -7,6 +7,10 @@ import (
 	"strings"
 )
 
+// DefaultTokenKey is the token.crypt.key shipped with the server. Being public, tokens signed with it
+// prove nothing, the server refuses to run with it while server.auth.enable is set.
+const DefaultTokenKey = "th15mustb3CH@ngedINprodUCT10N"
+
 var (
 	defCfg      map[string]string
 	initialized = false
@@ -23,13 +27,15 @@ func initialize() {
 
 	defCfg["server.host"] = "localhost"
 	defCfg["server.port"] = "3000"
-	defCfg["server.log.level"] = "warn" // valid values are trace, debug, info, warn, error, fatal
+	defCfg["server.log.level"] = "warn"  // valid values are trace, debug, info, warn, error, fatal
+	defCfg["server.log.access"] = "true" // write a JSON access log line per request to stdout
 
 	defCfg["server.timeout.write"] = "15 seconds"
 	defCfg["server.timeout.read"] = "15 seconds"
 	defCfg["server.timeout.idle"] = "60 seconds"
 
 	defCfg["server.timeout.graceshut"] = "15 seconds"
+	defCfg["server.timeout.unready"] = "5 seconds" // how long /readyz fails before shutting down
 	defCfg["server.http.cors.enable"] = "true"
 	defCfg["server.http.cors.allow.origins"] = "*"
 	defCfg["server.http.cors.allow.credential"] = "true"
@@ -38,14 +44,30 @@ func initialize() {
 	defCfg["server.http.cors.exposed.headers"] = "*"
 	defCfg["server.http.cors.optionpassthrough"] = "true"
 	defCfg["server.http.cors.maxage"] = "300"
+	defCfg["server.http.compression.enable"] = "true" // compress chunk and listing responses as negotiated with Accept-Encoding
+	defCfg["server.http.compression.minsize"] = "1024"
+	defCfg["server.chunk.batch.max"] = "256"    // most chunks sent in a single batch response
+	defCfg["server.http.trust.proxy"] = "false" // take the client IP from X-Forwarded-For and X-Real-IP
+
+	defCfg["server.ratelimit.enable"] = "true"
+	defCfg["server.ratelimit.default"] = "100/200"                                                             // requests per second and burst, per client and route, 0 means unlimited
+	defCfg["server.ratelimit.routes"] = "/path/{b64path}/chunk/info=5/20,/path/{b64path}/chunk/manifest=10/50" // route=rate/burst overrides, by route template
+
+	defCfg["server.throttle.enable"] = "false"
+	defCfg["server.throttle.global"] = "0"  // bytes per second sent by all chunk and bundle downloads together, eg. "10mb", 0 means unlimited
+	defCfg["server.throttle.client"] = "0"  // bytes per second per client, named by its token subject or its IP
+	defCfg["server.throttle.ip"] = "0"      // bytes per second per client IP
+	defCfg["server.throttle.schedule"] = "" // limits by time of day, eg. "07:00-22:00 global=2mb client=256kb; 22:00-07:00 global=0"
 
 	defCfg["token.issuer"] = "aaa.domain.com"
 	defCfg["token.access.duration"] = "5 minutes"
 	defCfg["token.refresh.duration"] = "1 year"
 
-	defCfg["token.crypt.key"] = "th15mustb3CH@ngedINprodUCT10N"
+	defCfg["token.crypt.key"] = DefaultTokenKey // must be changed, to at least 32 characters, when auth is enabled
 	defCfg["token.crypt.method"] = "HS512"
 
+	defCfg["server.auth.enable"] = "true" // require a bearer token on every endpoint changing the media library
+
 	defCfg["hansip.domain"] = "hansip"
 	defCfg["hansip.admin"] = "admin"
 
@@ -53,6 +75,33 @@ func initialize() {
 	defCfg["security.passphrase.minwords"] = "3"
 	defCfg["security.passphrase.mincharsinword"] = "3"
 
+	defCfg["media.roots"] = ""  // comma separated list of directories served and indexed by this server
+	defCfg["media.mounts"] = "" // comma separated name=target list, eg. "campaigns=/data/ads,brand-assets=s3://bucket/prefix"
+	defCfg["media.index.rescan"] = "5 minutes"
+	defCfg["media.index.watch"] = "true"
+	defCfg["media.search.limit"] = "100"
+	defCfg["media.delete.trash"] = "true" // deleted files go to the trash of their root unless asked otherwise
+	defCfg["media.trash.retention"] = "30 days"
+	defCfg["media.trash.purge.interval"] = "1 hour"
+	defCfg["media.chunks.index"] = "true"   // index the chunks of every file so /chunks/{hash} serves them
+	defCfg["media.chunks.chunking"] = "cdc" // how indexed files are cut, fixed or cdc
+	defCfg["media.manifest.cache"] = "1024" // how many chunk manifests are kept in memory, 0 caches none
+
+	defCfg["storage.s3.mount"] = "" // local path the bucket is served at, empty disables the s3 storage
+	defCfg["storage.s3.endpoint"] = "https://s3.amazonaws.com"
+	defCfg["storage.s3.region"] = "us-east-1"
+	defCfg["storage.s3.bucket"] = "" // bucket of storage.s3.mount, mounts name their own bucket
+	defCfg["storage.s3.prefix"] = ""
+	defCfg["storage.s3.access.key"] = ""
+	defCfg["storage.s3.secret.key"] = ""
+
+	defCfg["upload.staging.dir"] = "" // empty means a directory under the system temp directory
+	defCfg["upload.session.expiry"] = "1 day"
+	defCfg["upload.chunk.max"] = "8388608"   // largest chunk size, in bytes, an upload session may be initiated with
+	defCfg["upload.maxsize"] = "10737418240" // maximum size in bytes of a file uploaded by chunks, 0 means unlimited
+	defCfg["upload.tus.maxsize"] = "0"       // maximum tus upload size in bytes, 0 means unlimited
+	defCfg["upload.tus.baseurl"] = ""        // prefix of the tus upload Location, when served behind a proxy
+
 	for k := range defCfg {
 		err := viper.BindEnv(k)
 		if err != nil {
@@ -121,5 +170,8 @@ func GetFloat(key string) float64 {
 
 // Set configuration key value
 func Set(key, value string) {
+	if !initialized {
+		initialize()
+	}
 	defCfg[key] = value
 }
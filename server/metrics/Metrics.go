@@ -0,0 +1,305 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// DefBuckets are the upper bounds, in seconds, of the buckets of a latency histogram
+	DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	registry      = make(map[string]metric)
+	registryMutex sync.RWMutex
+)
+
+// metric is a family of series sharing a name, written in the Prometheus text exposition format
+type metric interface {
+	name() string
+	write(w io.Writer) error
+}
+
+// register adds m to the registry, returning the metric already registered under its name if any
+func register(m metric) metric {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if existing, ok := registry[m.name()]; ok {
+		return existing
+	}
+	registry[m.name()] = m
+	return m
+}
+
+// WriteText writes every registered metric in the Prometheus text exposition format, sorted by name
+func WriteText(w io.Writer) error {
+	registryMutex.RLock()
+	metrics := make([]metric, 0, len(registry))
+	for _, m := range registry {
+		metrics = append(metrics, m)
+	}
+	registryMutex.RUnlock()
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].name() < metrics[j].name()
+	})
+	for _, m := range metrics {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// family holds the values of the series of a metric, by label values
+type family struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+	mutex      sync.Mutex
+	series     map[string][]string
+}
+
+func newFamily(name, help, kind string, labels []string) family {
+	return family{metricName: name, help: help, kind: kind, labels: labels, series: make(map[string][]string)}
+}
+
+func (f *family) name() string {
+	return f.metricName
+}
+
+// key identifies the series of label values, which must be as many as the labels of the family
+func (f *family) key(labelValues []string) string {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.metricName, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	if _, ok := f.series[key]; !ok {
+		f.series[key] = append([]string{}, labelValues...)
+	}
+	return key
+}
+
+// sortedKeys lists the series sorted by label values
+func (f *family) sortedKeys() []string {
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *family) header(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.metricName, escapeHelp(f.help), f.metricName, f.kind)
+	return err
+}
+
+// labelString writes the labels of a series, with extra name and value pairs appended
+func (f *family) labelString(labelValues []string, extra ...string) string {
+	pairs := make([]string, 0, len(labelValues)+len(extra)/2)
+	for i, value := range labelValues {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", f.labels[i], escapeLabel(value)))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra[i], escapeLabel(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter is a value that only goes up, eg. a number of requests
+type Counter struct {
+	family
+	values map[string]float64
+}
+
+// NewCounter registers a counter with the specified label names
+func NewCounter(name, help string, labels ...string) *Counter {
+	return register(&Counter{family: newFamily(name, help, "counter", labels), values: make(map[string]float64)}).(*Counter)
+}
+
+// Inc adds one to the series of the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the series of the label values
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.values[c.key(labelValues)] += v
+}
+
+// Value returns the value of the series of the label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.values[c.key(labelValues)]
+}
+
+func (c *Counter) write(w io.Writer) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return writeValues(w, &c.family, c.values)
+}
+
+// Gauge is a value that goes up and down, eg. a number of open connections
+type Gauge struct {
+	family
+	values map[string]float64
+}
+
+// NewGauge registers a gauge with the specified label names
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return register(&Gauge{family: newFamily(name, help, "gauge", labels), values: make(map[string]float64)}).(*Gauge)
+}
+
+// Set sets the series of the label values to v
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.values[g.key(labelValues)] = v
+}
+
+// Add adds v, possibly negative, to the series of the label values
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.values[g.key(labelValues)] += v
+}
+
+// Value returns the value of the series of the label values
+func (g *Gauge) Value(labelValues ...string) float64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.values[g.key(labelValues)]
+}
+
+func (g *Gauge) write(w io.Writer) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return writeValues(w, &g.family, g.values)
+}
+
+func writeValues(w io.Writer, f *family, values map[string]float64) error {
+	if err := f.header(w); err != nil {
+		return err
+	}
+	for _, key := range f.sortedKeys() {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", f.metricName, f.labelString(f.series[key]), formatFloat(values[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Histogram counts observations, eg. durations, in buckets of increasing upper bounds
+type Histogram struct {
+	family
+	buckets []float64
+	counts  map[string][]uint64
+	sums    map[string]float64
+}
+
+// NewHistogram registers a histogram with the specified bucket upper bounds and label names
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	return register(&Histogram{
+		family:  newFamily(name, help, "histogram", labels),
+		buckets: sorted,
+		counts:  make(map[string][]uint64),
+		sums:    make(map[string]float64),
+	}).(*Histogram)
+}
+
+// Observe records v in the series of the label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	key := h.key(labelValues)
+	counts := h.countsOf(key)
+	for i, bound := range h.buckets {
+		if v <= bound {
+			counts[i]++
+		}
+	}
+	counts[len(h.buckets)]++
+	h.sums[key] += v
+}
+
+// Touch creates the series of the label values, with no observation, so it is written before its first one
+func (h *Histogram) Touch(labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.countsOf(h.key(labelValues))
+}
+
+// Count returns the number of observations of the series of the label values
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.countsOf(h.key(labelValues))[len(h.buckets)]
+}
+
+// countsOf returns the cumulative bucket counts of a series, the last one counting every observation
+func (h *Histogram) countsOf(key string) []uint64 {
+	counts, ok := h.counts[key]
+	if !ok {
+		counts = make([]uint64, len(h.buckets)+1)
+		h.counts[key] = counts
+	}
+	return counts
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if err := h.header(w); err != nil {
+		return err
+	}
+	for _, key := range h.sortedKeys() {
+		labelValues := h.series[key]
+		counts := h.countsOf(key)
+		for i, bound := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelString(labelValues, "le", formatFloat(bound)), counts[i]); err != nil {
+				return err
+			}
+		}
+		total := counts[len(h.buckets)]
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.metricName, h.labelString(labelValues, "le", "+Inf"), total,
+			h.metricName, h.labelString(labelValues), formatFloat(h.sums[key]),
+			h.metricName, h.labelString(labelValues), total); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	requests := NewCounter("test_requests_total", "Requests served", "route", "code")
+	requests.Inc("/path/{b64path}/files", "200")
+	requests.Add(2, "/path/{b64path}/files", "200")
+	requests.Inc("/roots", "503")
+	assert.Same(t, requests, NewCounter("test_requests_total", "Requests served", "route", "code"))
+
+	connections := NewGauge("test_connections", "Open connections")
+	connections.Add(2)
+	connections.Add(-1)
+
+	latency := NewHistogram("test_duration_seconds", "Latency", []float64{0.1, 1}, "route")
+	latency.Observe(0.05, `/say "hi"`)
+	latency.Observe(0.5, `/say "hi"`)
+	latency.Observe(5, `/say "hi"`)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteText(buf))
+	assert.Equal(t, `# HELP test_connections Open connections
+# TYPE test_connections gauge
+test_connections 1
+# HELP test_duration_seconds Latency
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/say \"hi\"",le="0.1"} 1
+test_duration_seconds_bucket{route="/say \"hi\"",le="1"} 2
+test_duration_seconds_bucket{route="/say \"hi\"",le="+Inf"} 3
+test_duration_seconds_sum{route="/say \"hi\""} 5.55
+test_duration_seconds_count{route="/say \"hi\""} 3
+# HELP test_requests_total Requests served
+# TYPE test_requests_total counter
+test_requests_total{route="/path/{b64path}/files",code="200"} 3
+test_requests_total{route="/roots",code="503"} 1
+`, buf.String())
+}
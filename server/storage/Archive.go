@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Archive is a read-only Storage over the entries of a ZIP or TAR file held by another storage.
+// Nothing is extracted: entries are read from the archive file on demand.
+type Archive struct {
+	entries map[string]*archiveEntry
+}
+
+type archiveEntry struct {
+	info fs.FileInfo
+	// open returns the content of a compressed file entry
+	open func() (io.ReadCloser, error)
+	// section is set when the entry is stored uncompressed, so it can be read at any offset
+	section *io.SectionReader
+}
+
+// IsArchive tells whether name is a file Adverter can browse as an archive
+func IsArchive(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".zip" || ext == ".tar"
+}
+
+// OpenArchive indexes the archive file name of store
+func OpenArchive(store Storage, name string) (*Archive, error) {
+	info, err := store.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() || !IsArchive(name) {
+		return nil, pathError("open", name, fs.ErrInvalid)
+	}
+	reader := &storeReaderAt{store: store, name: name}
+	archive := &Archive{entries: map[string]*archiveEntry{
+		".": {info: &memInfo{name: ".", mode: fs.ModeDir | 0555, modTime: info.ModTime()}},
+	}}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".zip":
+		err = archive.indexZip(reader, info.Size())
+	case ".tar":
+		err = archive.indexTar(reader, info.Size())
+	}
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return archive, nil
+}
+
+func (archive *Archive) indexZip(reader io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(reader, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		f := f
+		name := strings.TrimSuffix(f.Name, "/")
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		if f.FileInfo().IsDir() {
+			archive.addDir(name, f.Modified)
+			continue
+		}
+		entry := &archiveEntry{info: f.FileInfo(), open: func() (io.ReadCloser, error) { return f.Open() }}
+		if f.Method == zip.Store {
+			if offset, err := f.DataOffset(); err == nil {
+				entry.section = io.NewSectionReader(reader, offset, int64(f.UncompressedSize64))
+			}
+		}
+		archive.addFile(name, entry)
+	}
+	return nil
+}
+
+func (archive *Archive) indexTar(reader io.ReaderAt, size int64) error {
+	counter := &countingReader{reader: io.NewSectionReader(reader, 0, size)}
+	tr := tar.NewReader(counter)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(path.Clean(hdr.Name), "/")
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			archive.addDir(name, hdr.ModTime)
+		case tar.TypeReg:
+			section := io.NewSectionReader(reader, counter.offset, hdr.Size)
+			archive.addFile(name, &archiveEntry{info: hdr.FileInfo(), section: section})
+		}
+	}
+}
+
+func (archive *Archive) addFile(name string, entry *archiveEntry) {
+	archive.addDir(path.Dir(name), entry.info.ModTime())
+	archive.entries[name] = entry
+}
+
+func (archive *Archive) addDir(name string, modTime time.Time) {
+	for p := name; p != "."; p = path.Dir(p) {
+		if _, ok := archive.entries[p]; ok {
+			return
+		}
+		archive.entries[p] = &archiveEntry{info: &memInfo{name: path.Base(p), mode: fs.ModeDir | 0555, modTime: modTime}}
+	}
+}
+
+func (archive *Archive) Open(name string) (fs.File, error) {
+	entry, err := archive.entry("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.info.IsDir() {
+		return &memDir{info: entry.info, entries: archive.children(name)}, nil
+	}
+	if entry.section != nil {
+		return &archiveSectionFile{SectionReader: io.NewSectionReader(entry.section, 0, entry.section.Size()), info: entry.info}, nil
+	}
+	rc, err := entry.open()
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return &archiveFile{ReadCloser: rc, info: entry.info}, nil
+}
+
+func (archive *Archive) Stat(name string) (fs.FileInfo, error) {
+	entry, err := archive.entry("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return entry.info, nil
+}
+
+func (archive *Archive) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := archive.entry("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.info.IsDir() {
+		return nil, pathError("readdir", name, fs.ErrInvalid)
+	}
+	return archive.children(name), nil
+}
+
+// ReadRange reads straight from the archive file for uncompressed entries, and decompresses
+// the entry up to the range otherwise
+func (archive *Archive) ReadRange(name string, offset, length int64) ([]byte, error) {
+	entry, err := archive.entry("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.info.IsDir() {
+		return nil, pathError("read", name, fs.ErrInvalid)
+	}
+	data := make([]byte, length)
+	if entry.section != nil {
+		n, err := entry.section.ReadAt(data, offset)
+		if err != nil && err != io.EOF {
+			return nil, pathError("read", name, err)
+		}
+		return data[:n], nil
+	}
+	rc, err := entry.open()
+	if err != nil {
+		return nil, pathError("read", name, err)
+	}
+	defer rc.Close()
+	if _, err := io.CopyN(io.Discard, rc, offset); err != nil && err != io.EOF {
+		return nil, pathError("read", name, err)
+	}
+	n, err := io.ReadFull(rc, data)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, pathError("read", name, err)
+	}
+	return data[:n], nil
+}
+
+func (archive *Archive) Create(name string) (FileWriter, error) {
+	return nil, pathError("create", name, fs.ErrPermission)
+}
+
+func (archive *Archive) Mkdir(name string, perm fs.FileMode) error {
+	return pathError("mkdir", name, fs.ErrPermission)
+}
+
+func (archive *Archive) MkdirAll(name string, perm fs.FileMode) error {
+	return pathError("mkdir", name, fs.ErrPermission)
+}
+
+func (archive *Archive) Remove(name string) error {
+	return pathError("remove", name, fs.ErrPermission)
+}
+
+func (archive *Archive) RemoveAll(name string) error {
+	return pathError("remove", name, fs.ErrPermission)
+}
+
+func (archive *Archive) Rename(oldName, newName string) error {
+	return pathError("rename", oldName, fs.ErrPermission)
+}
+
+func (archive *Archive) entry(op, name string) (*archiveEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, pathError(op, name, fs.ErrInvalid)
+	}
+	entry, ok := archive.entries[name]
+	if !ok {
+		return nil, pathError(op, name, fs.ErrNotExist)
+	}
+	return entry, nil
+}
+
+// children lists the direct children of the directory name, sorted by name
+func (archive *Archive) children(name string) []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0)
+	for p, e := range archive.entries {
+		if p != "." && path.Dir(p) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(e.info))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries
+}
+
+type archiveFile struct {
+	io.ReadCloser
+	info fs.FileInfo
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+type archiveSectionFile struct {
+	*io.SectionReader
+	info fs.FileInfo
+}
+
+func (f *archiveSectionFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *archiveSectionFile) Close() error               { return nil }
+
+// storeReaderAt reads a file of a storage at arbitrary offsets
+type storeReaderAt struct {
+	store Storage
+	name  string
+}
+
+func (r *storeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	data, err := ReadRange(r.store, r.name, off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// countingReader keeps the offset reached in the underlying reader
+type countingReader struct {
+	reader io.ReadSeeker
+	offset int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// Seek lets the tar reader skip over file data instead of reading it
+func (r *countingReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.reader.Seek(offset, whence)
+	if err == nil {
+		r.offset = pos
+	}
+	return pos, err
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func zipOf(t *testing.T, files map[string]string, method uint16) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func tarOf(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for name, content := range files {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestArchive(t *testing.T) {
+	files := map[string]string{
+		"banner/index.html": strings.Repeat("<html>", 1000),
+		"banner/logo.png":   "logo",
+		"readme.txt":        "readme",
+		"../escape.txt":     "escape",
+	}
+	mem := NewMemory()
+	assert.NoError(t, WriteFile(mem, "stored.zip", zipOf(t, files, zip.Store)))
+	assert.NoError(t, WriteFile(mem, "deflated.zip", zipOf(t, files, zip.Deflate)))
+	assert.NoError(t, WriteFile(mem, "bundle.tar", tarOf(t, files)))
+
+	for _, name := range []string{"stored.zip", "deflated.zip", "bundle.tar"} {
+		t.Run(name, func(t *testing.T) {
+			archive, err := OpenArchive(mem, name)
+			assert.NoError(t, err)
+			assert.NoError(t, fstest.TestFS(archive, "banner/index.html", "banner/logo.png", "readme.txt"))
+
+			entries, err := archive.ReadDir(".")
+			assert.NoError(t, err)
+			assert.Len(t, entries, 2)
+
+			data, err := ReadRange(archive, "banner/index.html", 6, 12)
+			assert.NoError(t, err)
+			assert.Equal(t, "<html><html>", string(data))
+			data, err = ReadRange(archive, "readme.txt", 4, 10)
+			assert.NoError(t, err)
+			assert.Equal(t, "me", string(data))
+
+			assert.ErrorIs(t, WriteFile(archive, "new.txt", []byte("new")), fs.ErrPermission)
+		})
+	}
+
+	_, err := OpenArchive(mem, "missing.zip")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Local is a Storage on the local disk, below a root directory
+type Local struct {
+	root string
+}
+
+// NewLocal creates a local disk storage whose "." is the directory root
+func NewLocal(root string) *Local {
+	return &Local{
+		root: root,
+	}
+}
+
+// Root returns the directory this storage is rooted at
+func (local *Local) Root() string {
+	return local.root
+}
+
+// OSPath returns the local disk path of the named file
+func (local *Local) OSPath(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", fs.ErrInvalid
+	}
+	return filepath.Join(local.root, filepath.FromSlash(name)), nil
+}
+
+func (local *Local) Open(name string) (fs.File, error) {
+	p, err := local.OSPath(name)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return os.Open(p)
+}
+
+func (local *Local) Stat(name string) (fs.FileInfo, error) {
+	p, err := local.OSPath(name)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return os.Stat(p)
+}
+
+func (local *Local) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := local.OSPath(name)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	return os.ReadDir(p)
+}
+
+// Create writes into a temporary file next to name, renamed into name when closed.
+// The file is left readable by everyone (0644) unless the writer is given another mode with SetMode.
+func (local *Local) Create(name string) (FileWriter, error) {
+	p, err := local.OSPath(name)
+	if err != nil {
+		return nil, pathError("create", name, err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".adverter-*")
+	if err != nil {
+		return nil, err
+	}
+	return &localWriter{File: f, target: p, mode: 0644}, nil
+}
+
+func (local *Local) Mkdir(name string, perm fs.FileMode) error {
+	p, err := local.OSPath(name)
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+	return os.Mkdir(p, perm)
+}
+
+func (local *Local) MkdirAll(name string, perm fs.FileMode) error {
+	p, err := local.OSPath(name)
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+	return os.MkdirAll(p, perm)
+}
+
+func (local *Local) Remove(name string) error {
+	p, err := local.OSPath(name)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	return os.Remove(p)
+}
+
+func (local *Local) RemoveAll(name string) error {
+	p, err := local.OSPath(name)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	return os.RemoveAll(p)
+}
+
+func (local *Local) Rename(oldName, newName string) error {
+	oldPath, err := local.OSPath(oldName)
+	if err != nil {
+		return pathError("rename", oldName, err)
+	}
+	newPath, err := local.OSPath(newName)
+	if err != nil {
+		return pathError("rename", newName, err)
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+type localWriter struct {
+	*os.File
+	target string
+	mode   fs.FileMode
+}
+
+// SetMode sets the permission bits the file gets once closed
+func (w *localWriter) SetMode(mode fs.FileMode) {
+	w.mode = mode.Perm()
+}
+
+func (w *localWriter) Close() error {
+	// os.CreateTemp makes 0600 files, which would not survive the rename as the mode of a media file
+	if err := w.File.Chmod(w.mode); err != nil {
+		_ = w.File.Close()
+		_ = os.Remove(w.Name())
+		return err
+	}
+	if err := w.File.Close(); err != nil {
+		_ = os.Remove(w.Name())
+		return err
+	}
+	if err := os.Rename(w.Name(), w.target); err != nil {
+		_ = os.Remove(w.Name())
+		return err
+	}
+	return nil
+}
+
+func (w *localWriter) Abort() error {
+	_ = w.File.Close()
+	return os.Remove(w.Name())
+}
@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is a Storage held entirely in memory, meant for tests and small scratch trees
+type Memory struct {
+	nodes map[string]*memNode
+	mutex sync.RWMutex
+}
+
+type memNode struct {
+	name    string
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMemory creates an empty in-memory storage
+func NewMemory() *Memory {
+	return &Memory{
+		nodes: map[string]*memNode{
+			".": {name: ".", mode: fs.ModeDir | 0755, modTime: time.Now()},
+		},
+	}
+}
+
+func (mem *Memory) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, pathError("open", name, fs.ErrInvalid)
+	}
+	mem.mutex.RLock()
+	defer mem.mutex.RUnlock()
+	node, ok := mem.nodes[name]
+	if !ok {
+		return nil, pathError("open", name, fs.ErrNotExist)
+	}
+	if node.mode.IsDir() {
+		return &memDir{info: node.info(), entries: mem.children(name)}, nil
+	}
+	return &memFile{info: node.info(), Reader: bytes.NewReader(node.data)}, nil
+}
+
+func (mem *Memory) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, pathError("stat", name, fs.ErrInvalid)
+	}
+	mem.mutex.RLock()
+	defer mem.mutex.RUnlock()
+	node, ok := mem.nodes[name]
+	if !ok {
+		return nil, pathError("stat", name, fs.ErrNotExist)
+	}
+	return node.info(), nil
+}
+
+func (mem *Memory) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, pathError("readdir", name, fs.ErrInvalid)
+	}
+	mem.mutex.RLock()
+	defer mem.mutex.RUnlock()
+	node, ok := mem.nodes[name]
+	if !ok {
+		return nil, pathError("readdir", name, fs.ErrNotExist)
+	}
+	if !node.mode.IsDir() {
+		return nil, pathError("readdir", name, fs.ErrInvalid)
+	}
+	return mem.children(name), nil
+}
+
+func (mem *Memory) Create(name string) (FileWriter, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, pathError("create", name, fs.ErrInvalid)
+	}
+	mem.mutex.RLock()
+	defer mem.mutex.RUnlock()
+	if err := mem.checkParent("create", name); err != nil {
+		return nil, err
+	}
+	if node, ok := mem.nodes[name]; ok && node.mode.IsDir() {
+		return nil, pathError("create", name, fs.ErrExist)
+	}
+	return &memWriter{mem: mem, name: name}, nil
+}
+
+func (mem *Memory) Mkdir(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return pathError("mkdir", name, fs.ErrInvalid)
+	}
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	if _, ok := mem.nodes[name]; ok {
+		return pathError("mkdir", name, fs.ErrExist)
+	}
+	if err := mem.checkParent("mkdir", name); err != nil {
+		return err
+	}
+	mem.nodes[name] = &memNode{name: path.Base(name), mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	return nil
+}
+
+func (mem *Memory) MkdirAll(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return pathError("mkdir", name, fs.ErrInvalid)
+	}
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	for p := name; p != "."; p = path.Dir(p) {
+		if node, ok := mem.nodes[p]; ok {
+			if !node.mode.IsDir() {
+				return pathError("mkdir", p, fs.ErrExist)
+			}
+			continue
+		}
+		mem.nodes[p] = &memNode{name: path.Base(p), mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	}
+	return nil
+}
+
+func (mem *Memory) Remove(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return pathError("remove", name, fs.ErrInvalid)
+	}
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	if _, ok := mem.nodes[name]; !ok {
+		return pathError("remove", name, fs.ErrNotExist)
+	}
+	if len(mem.children(name)) > 0 {
+		return pathError("remove", name, fs.ErrExist)
+	}
+	delete(mem.nodes, name)
+	return nil
+}
+
+func (mem *Memory) RemoveAll(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return pathError("remove", name, fs.ErrInvalid)
+	}
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	for p := range mem.nodes {
+		if p == name || strings.HasPrefix(p, name+"/") {
+			delete(mem.nodes, p)
+		}
+	}
+	return nil
+}
+
+func (mem *Memory) Rename(oldName, newName string) error {
+	if !fs.ValidPath(oldName) || oldName == "." {
+		return pathError("rename", oldName, fs.ErrInvalid)
+	}
+	if !fs.ValidPath(newName) || newName == "." {
+		return pathError("rename", newName, fs.ErrInvalid)
+	}
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	node, ok := mem.nodes[oldName]
+	if !ok {
+		return pathError("rename", oldName, fs.ErrNotExist)
+	}
+	if err := mem.checkParent("rename", newName); err != nil {
+		return err
+	}
+	if existing, ok := mem.nodes[newName]; ok && (existing.mode.IsDir() || node.mode.IsDir()) {
+		return pathError("rename", newName, fs.ErrExist)
+	}
+	if node.mode.IsDir() && strings.HasPrefix(newName, oldName+"/") {
+		return pathError("rename", newName, fs.ErrInvalid)
+	}
+	moved := make(map[string]*memNode)
+	for p, n := range mem.nodes {
+		if p == oldName || strings.HasPrefix(p, oldName+"/") {
+			moved[newName+p[len(oldName):]] = n
+			delete(mem.nodes, p)
+		}
+	}
+	for p, n := range moved {
+		n.name = path.Base(p)
+		mem.nodes[p] = n
+	}
+	return nil
+}
+
+// children lists the direct children of the directory name, sorted by name. The caller holds the lock.
+func (mem *Memory) children(name string) []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0)
+	for p, n := range mem.nodes {
+		if p != "." && path.Dir(p) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(n.info()))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries
+}
+
+// checkParent makes sure the parent directory of name exists. The caller holds the lock.
+func (mem *Memory) checkParent(op, name string) error {
+	parent, ok := mem.nodes[path.Dir(name)]
+	if !ok {
+		return pathError(op, name, fs.ErrNotExist)
+	}
+	if !parent.mode.IsDir() {
+		return pathError(op, name, fs.ErrInvalid)
+	}
+	return nil
+}
+
+func (node *memNode) info() fs.FileInfo {
+	return &memInfo{name: node.name, size: int64(len(node.data)), mode: node.mode, modTime: node.modTime}
+}
+
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (info *memInfo) Name() string       { return info.name }
+func (info *memInfo) Size() int64        { return info.size }
+func (info *memInfo) Mode() fs.FileMode  { return info.mode }
+func (info *memInfo) ModTime() time.Time { return info.modTime }
+func (info *memInfo) IsDir() bool        { return info.mode.IsDir() }
+func (info *memInfo) Sys() any           { return nil }
+
+type memFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Close() error               { return nil }
+
+type memDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, pathError("read", d.info.Name(), fs.ErrInvalid)
+}
+
+func (d *memDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(remaining) {
+		count = len(remaining)
+	}
+	d.offset += count
+	return remaining[:count], nil
+}
+
+type memWriter struct {
+	bytes.Buffer
+	mem  *Memory
+	name string
+}
+
+func (w *memWriter) Close() error {
+	w.mem.mutex.Lock()
+	defer w.mem.mutex.Unlock()
+	if err := w.mem.checkParent("create", w.name); err != nil {
+		return err
+	}
+	w.mem.nodes[w.name] = &memNode{name: path.Base(w.name), data: w.Bytes(), mode: 0644, modTime: time.Now()}
+	return nil
+}
+
+func (w *memWriter) Abort() error {
+	w.Reset()
+	return nil
+}
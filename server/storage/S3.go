@@ -0,0 +1,646 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Service         = "s3"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3TimeFormat      = "20060102T150405Z"
+)
+
+// S3Config holds the connection parameters of an S3 compatible bucket
+type S3Config struct {
+	// Endpoint is the base URL of the service, eg. "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000"
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3 is a Storage on an S3 compatible bucket, addressed path-style. Every object below Prefix is a file,
+// every key prefix ending with a slash is a directory. Directories made by Mkdir are kept as empty
+// marker objects named after the directory with a trailing slash.
+type S3 struct {
+	config S3Config
+	client *http.Client
+}
+
+// NewS3 creates a storage on the bucket described by config
+func NewS3(config S3Config, client *http.Client) *S3 {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	config.Prefix = strings.Trim(config.Prefix, "/")
+	if len(config.Region) == 0 {
+		config.Region = "us-east-1"
+	}
+	return &S3{
+		config: config,
+		client: client,
+	}
+}
+
+func (s3 *S3) Open(name string) (fs.File, error) {
+	info, err := s3.Stat(name)
+	if err != nil {
+		return nil, pathError("open", name, unwrapPathError(err))
+	}
+	if info.IsDir() {
+		entries, err := s3.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &memDir{info: info, entries: entries}, nil
+	}
+	return &s3File{s3: s3, name: name, info: info}, nil
+}
+
+func (s3 *S3) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, pathError("stat", name, fs.ErrInvalid)
+	}
+	if name == "." {
+		return &memInfo{name: ".", mode: fs.ModeDir | 0755}, nil
+	}
+	resp, err := s3.do(http.MethodHead, s3.key(name), nil, nil, nil)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+		modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return &memInfo{name: path.Base(name), size: size, mode: 0644, modTime: modTime}, nil
+	case http.StatusNotFound:
+		list, err := s3.list(s3.key(name)+"/", "", "", 1)
+		if err != nil {
+			return nil, pathError("stat", name, err)
+		}
+		if len(list.Contents) == 0 && len(list.CommonPrefixes) == 0 {
+			return nil, pathError("stat", name, fs.ErrNotExist)
+		}
+		return &memInfo{name: path.Base(name), mode: fs.ModeDir | 0755}, nil
+	default:
+		return nil, pathError("stat", name, fmt.Errorf("unexpected status %s", resp.Status))
+	}
+}
+
+func (s3 *S3) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, pathError("readdir", name, fs.ErrInvalid)
+	}
+	prefix := s3.dirKey(name)
+	entries := make([]fs.DirEntry, 0)
+	found := name == "."
+	token := ""
+	for {
+		list, err := s3.list(prefix, "/", token, 1000)
+		if err != nil {
+			return nil, pathError("readdir", name, err)
+		}
+		for _, p := range list.CommonPrefixes {
+			found = true
+			dirName := strings.TrimSuffix(p.Prefix[len(prefix):], "/")
+			if len(dirName) > 0 {
+				entries = append(entries, fs.FileInfoToDirEntry(&memInfo{name: dirName, mode: fs.ModeDir | 0755}))
+			}
+		}
+		for _, c := range list.Contents {
+			found = true
+			fileName := c.Key[len(prefix):]
+			if len(fileName) == 0 {
+				continue
+			}
+			entries = append(entries, fs.FileInfoToDirEntry(&memInfo{name: fileName, size: c.Size, mode: 0644, modTime: c.LastModified}))
+		}
+		if !list.IsTruncated {
+			break
+		}
+		token = list.NextContinuationToken
+	}
+	if !found {
+		if info, err := s3.Stat(name); err != nil {
+			return nil, pathError("readdir", name, fs.ErrNotExist)
+		} else if !info.IsDir() {
+			return nil, pathError("readdir", name, fs.ErrInvalid)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// Create buffers the content into a temporary file, uploaded when closed
+func (s3 *S3) Create(name string) (FileWriter, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, pathError("create", name, fs.ErrInvalid)
+	}
+	if err := s3.checkParent("create", name); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp("", "adverter-s3-*")
+	if err != nil {
+		return nil, err
+	}
+	return &s3Writer{File: f, s3: s3, name: name}, nil
+}
+
+func (s3 *S3) Mkdir(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) || name == "." {
+		return pathError("mkdir", name, fs.ErrInvalid)
+	}
+	if _, err := s3.Stat(name); err == nil {
+		return pathError("mkdir", name, fs.ErrExist)
+	}
+	if err := s3.checkParent("mkdir", name); err != nil {
+		return err
+	}
+	return s3.putMarker(name)
+}
+
+func (s3 *S3) MkdirAll(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return pathError("mkdir", name, fs.ErrInvalid)
+	}
+	if name == "." {
+		return nil
+	}
+	if info, err := s3.Stat(name); err == nil {
+		if !info.IsDir() {
+			return pathError("mkdir", name, fs.ErrExist)
+		}
+		return nil
+	}
+	return s3.putMarker(name)
+}
+
+func (s3 *S3) Remove(name string) error {
+	info, err := s3.Stat(name)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return s3.deleteKey(s3.key(name))
+	}
+	entries, err := s3.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return pathError("remove", name, fs.ErrExist)
+	}
+	return s3.deleteKey(s3.dirKey(name))
+}
+
+func (s3 *S3) RemoveAll(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return pathError("remove", name, fs.ErrInvalid)
+	}
+	keys, err := s3.keysBelow(name)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := s3.deleteKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rename copies every object of oldName server side, then deletes the originals
+func (s3 *S3) Rename(oldName, newName string) error {
+	if !fs.ValidPath(newName) || newName == "." {
+		return pathError("rename", newName, fs.ErrInvalid)
+	}
+	info, err := s3.Stat(oldName)
+	if err != nil {
+		return err
+	}
+	if err := s3.checkParent("rename", newName); err != nil {
+		return err
+	}
+	if existing, err := s3.Stat(newName); err == nil && (existing.IsDir() || info.IsDir()) {
+		return pathError("rename", newName, fs.ErrExist)
+	}
+	keys := []string{s3.key(oldName)}
+	if info.IsDir() {
+		if strings.HasPrefix(newName, oldName+"/") {
+			return pathError("rename", newName, fs.ErrInvalid)
+		}
+		if keys, err = s3.keysBelow(oldName); err != nil {
+			return err
+		}
+	}
+	oldKey, newKey := s3.key(oldName), s3.key(newName)
+	for _, key := range keys {
+		if err := s3.copyKey(key, newKey+key[len(oldKey):]); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		if err := s3.deleteKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadRange reads length bytes of the named file starting at offset with a ranged GET
+func (s3 *S3) ReadRange(name string, offset, length int64) ([]byte, error) {
+	if length <= 0 {
+		return []byte{}, nil
+	}
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	resp, err := s3.do(http.MethodGet, s3.key(name), nil, header, nil)
+	if err != nil {
+		return nil, pathError("read", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return []byte{}, nil
+	}
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		return nil, pathError("read", name, s3StatusError(resp))
+	}
+	if resp.StatusCode == http.StatusOK {
+		// the server ignored the range
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			return nil, pathError("read", name, err)
+		}
+	}
+	data := make([]byte, length)
+	n, err := io.ReadFull(resp.Body, data)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, pathError("read", name, err)
+	}
+	return data[:n], nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s3 *S3) list(prefix, delimiter, token string, maxKeys int) (*s3ListResult, error) {
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("prefix", prefix)
+	query.Set("max-keys", strconv.Itoa(maxKeys))
+	if len(delimiter) > 0 {
+		query.Set("delimiter", delimiter)
+	}
+	if len(token) > 0 {
+		query.Set("continuation-token", token)
+	}
+	resp, err := s3.do(http.MethodGet, "", query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3StatusError(resp)
+	}
+	result := &s3ListResult{}
+	if err := xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// keysBelow lists the object of name itself and every object below it
+func (s3 *S3) keysBelow(name string) ([]string, error) {
+	keys := make([]string, 0)
+	if info, err := s3.Stat(name); err == nil && !info.IsDir() {
+		keys = append(keys, s3.key(name))
+	}
+	token := ""
+	for {
+		list, err := s3.list(s3.dirKey(name), "", token, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range list.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !list.IsTruncated {
+			return keys, nil
+		}
+		token = list.NextContinuationToken
+	}
+}
+
+func (s3 *S3) putMarker(name string) error {
+	resp, err := s3.do(http.MethodPut, s3.dirKey(name), nil, nil, bytes.NewReader(nil))
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return pathError("mkdir", name, s3StatusError(resp))
+	}
+	return nil
+}
+
+func (s3 *S3) copyKey(from, to string) error {
+	header := http.Header{}
+	header.Set("X-Amz-Copy-Source", "/"+s3.config.Bucket+"/"+s3EscapePath(from))
+	resp, err := s3.do(http.MethodPut, to, nil, header, bytes.NewReader(nil))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3StatusError(resp)
+	}
+	return nil
+}
+
+func (s3 *S3) deleteKey(key string) error {
+	resp, err := s3.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3StatusError(resp)
+	}
+	return nil
+}
+
+func (s3 *S3) checkParent(op, name string) error {
+	parent := path.Dir(name)
+	if parent == "." {
+		return nil
+	}
+	info, err := s3.Stat(parent)
+	if err != nil {
+		return pathError(op, name, fs.ErrNotExist)
+	}
+	if !info.IsDir() {
+		return pathError(op, name, fs.ErrInvalid)
+	}
+	return nil
+}
+
+// key returns the object key of a name
+func (s3 *S3) key(name string) string {
+	if name == "." {
+		return s3.config.Prefix
+	}
+	if len(s3.config.Prefix) == 0 {
+		return name
+	}
+	return s3.config.Prefix + "/" + name
+}
+
+// dirKey returns the key prefix of every object inside the directory name
+func (s3 *S3) dirKey(name string) string {
+	key := s3.key(name)
+	if len(key) == 0 {
+		return ""
+	}
+	return key + "/"
+}
+
+// do sends a request signed with AWS signature version 4. An empty key addresses the bucket itself.
+func (s3 *S3) do(method, key string, query url.Values, header http.Header, body io.ReadSeeker) (*http.Response, error) {
+	uri := "/" + s3.config.Bucket
+	if len(key) > 0 {
+		uri += "/" + key
+	}
+	reqURL := s3.config.Endpoint + s3EscapePath(uri)
+	if len(query) > 0 {
+		reqURL += "?" + s3CanonicalQuery(query)
+	}
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = body
+	}
+	req, err := http.NewRequest(method, reqURL, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		size, err := body.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		req.ContentLength = size
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s3.sign(req, time.Now().UTC())
+	return s3.client.Do(req)
+}
+
+func (s3 *S3) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format(s3TimeFormat)
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "range" || lk == "content-type" {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	canonicalHeaders := strings.Builder{}
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+	scope := day + "/" + s3.config.Region + "/" + s3Service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := s3HMAC([]byte("AWS4"+s3.config.SecretKey), day)
+	key = s3HMAC(key, s3.config.Region)
+	key = s3HMAC(key, s3Service)
+	key = s3HMAC(key, "aws4_request")
+	signature := hex.EncodeToString(s3HMAC(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3.config.AccessKey, scope, signedHeaders, signature))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath URI encodes every path segment the way signature version 4 expects
+func s3EscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = s3Escape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+func s3Escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			pairs = append(pairs, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func s3StatusError(resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return fs.ErrNotExist
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		return fs.ErrPermission
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("unexpected status %s %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+func unwrapPathError(err error) error {
+	if pe, ok := err.(*fs.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
+
+// s3File reads an object. Sequential reads stream a single GET, ReadAt uses ranged GETs.
+type s3File struct {
+	s3     *S3
+	name   string
+	info   fs.FileInfo
+	body   io.ReadCloser
+	offset int64
+}
+
+func (f *s3File) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *s3File) Read(p []byte) (int, error) {
+	if f.body == nil {
+		resp, err := f.s3.do(http.MethodGet, f.s3.key(f.name), nil, nil, nil)
+		if err != nil {
+			return 0, pathError("read", f.name, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return 0, pathError("read", f.name, s3StatusError(resp))
+		}
+		f.body = resp.Body
+	}
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *s3File) ReadAt(p []byte, off int64) (int, error) {
+	data, err := f.s3.ReadRange(f.name, off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *s3File) Close() error {
+	if f.body != nil {
+		return f.body.Close()
+	}
+	return nil
+}
+
+type s3Writer struct {
+	*os.File
+	s3   *S3
+	name string
+}
+
+func (w *s3Writer) Close() error {
+	defer os.Remove(w.Name())
+	if _, err := w.File.Seek(0, io.SeekStart); err != nil {
+		w.File.Close()
+		return err
+	}
+	resp, err := w.s3.do(http.MethodPut, w.s3.key(w.name), nil, nil, w.File)
+	w.File.Close()
+	if err != nil {
+		return pathError("create", w.name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return pathError("create", w.name, s3StatusError(resp))
+	}
+	return nil
+}
+
+func (w *s3Writer) Abort() error {
+	w.File.Close()
+	return os.Remove(w.Name())
+}
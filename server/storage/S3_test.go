@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an in-process stand-in for an S3 compatible service, serving a single bucket path-style
+type fakeS3 struct {
+	bucket  string
+	objects map[string][]byte
+	times   map[string]time.Time
+	ranges  int
+	mutex   sync.Mutex
+}
+
+type fakeListResult struct {
+	XMLName  xml.Name `xml:"ListBucketResult"`
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func newFakeS3(t *testing.T, prefix string) (*S3, *fakeS3) {
+	fake := &fakeS3{bucket: "media", objects: make(map[string][]byte), times: make(map[string]time.Time)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return NewS3(S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "media",
+		Prefix:    prefix,
+		AccessKey: "access",
+		SecretKey: "secret",
+	}, server.Client()), fake
+}
+
+func (fake *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"+fake.bucket), "/")
+	if len(key) == 0 {
+		fake.list(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		data, ok := fake.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Last-Modified", fake.times[key].Format(http.TimeFormat))
+		if rng := r.Header.Get("Range"); len(rng) > 0 {
+			fake.ranges++
+			var from, to int
+			fmt.Sscanf(rng, "bytes=%d-%d", &from, &to)
+			if from >= len(data) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			if to >= len(data) {
+				to = len(data) - 1
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(to-from+1))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[from : to+1])
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodPut:
+		if source := r.Header.Get("X-Amz-Copy-Source"); len(source) > 0 {
+			data, ok := fake.objects[strings.TrimPrefix(source, "/"+fake.bucket+"/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fake.put(key, data)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		fake.put(key, data)
+	case http.MethodDelete:
+		delete(fake.objects, key)
+		delete(fake.times, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (fake *fakeS3) put(key string, data []byte) {
+	fake.objects[key] = data
+	fake.times[key] = time.Now().Truncate(time.Second)
+}
+
+func (fake *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix, delimiter, token := query.Get("prefix"), query.Get("delimiter"), query.Get("continuation-token")
+	maxKeys, _ := strconv.Atoi(query.Get("max-keys"))
+	keys := make([]string, 0)
+	for k := range fake.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	result := &fakeListResult{}
+	count := 0
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) || (len(token) > 0 && (k <= token || strings.HasPrefix(k, token) && strings.HasSuffix(token, delimiter))) {
+			continue
+		}
+		if count == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		if i := strings.Index(k[len(prefix):], delimiter); len(delimiter) > 0 && i >= 0 {
+			common := k[:len(prefix)+i+1]
+			if n := len(result.CommonPrefixes); n == 0 || result.CommonPrefixes[n-1].Prefix != common {
+				result.CommonPrefixes = append(result.CommonPrefixes, struct{ Prefix string }{common})
+				result.NextContinuationToken = common
+				count++
+			}
+			continue
+		}
+		result.Contents = append(result.Contents, struct {
+			Key          string
+			Size         int64
+			LastModified time.Time
+		}{k, int64(len(fake.objects[k])), fake.times[k]})
+		result.NextContinuationToken = k
+		count++
+	}
+	if !result.IsTruncated {
+		result.NextContinuationToken = ""
+	}
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+func TestS3(t *testing.T) {
+	store, fake := newFakeS3(t, "ads")
+	assert.NoError(t, store.MkdirAll("campaign/summer", 0755))
+	for i := 0; i < 1500; i++ {
+		fake.put(fmt.Sprintf("ads/bulk/%04d.png", i), []byte("png"))
+	}
+	entries, err := store.ReadDir("bulk")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1500)
+
+	assert.NoError(t, WriteFile(store, "campaign/summer/intro.mp4", []byte("0123456789")))
+	data, err := ReadRange(store, "campaign/summer/intro.mp4", 4, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "456", string(data))
+	data, err = ReadRange(store, "campaign/summer/intro.mp4", 8, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "89", string(data))
+	data, err = ReadRange(store, "campaign/summer/intro.mp4", 20, 5)
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+	assert.Equal(t, 3, fake.ranges)
+
+	_, ok := fake.objects["ads/campaign/summer/intro.mp4"]
+	assert.True(t, ok)
+	_, err = store.Stat("campaign/winter")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
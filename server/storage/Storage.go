@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"io"
+	"io/fs"
+	"path"
+)
+
+// Storage is a hierarchical file store the media library is served from.
+// Reading follows io/fs, so any Storage can be used with fs.WalkDir, fs.ReadFile and the like.
+// Names are io/fs names: slash separated, unrooted, "." being the top of the store.
+type Storage interface {
+	fs.StatFS
+	fs.ReadDirFS
+
+	// Create creates or replaces the named file. The content written is only visible under name
+	// once the writer is closed successfully. Abort discards it instead.
+	Create(name string) (FileWriter, error)
+	// Mkdir creates the named directory. Its parent must exist.
+	Mkdir(name string, perm fs.FileMode) error
+	// MkdirAll creates the named directory along with any missing parent.
+	MkdirAll(name string, perm fs.FileMode) error
+	// Remove removes the named file or empty directory.
+	Remove(name string) error
+	// RemoveAll removes the named file or directory and everything below it.
+	// It returns nil if name does not exist.
+	RemoveAll(name string) error
+	// Rename moves oldName to newName, replacing newName if it is an existing file.
+	Rename(oldName, newName string) error
+}
+
+// FileWriter receives the content of a file made by Storage.Create
+type FileWriter interface {
+	io.WriteCloser
+	// Abort discards everything written so far. The file is left as it was before Create.
+	Abort() error
+}
+
+// modeSetter is implemented by the FileWriter of storages keeping file permission bits
+type modeSetter interface {
+	SetMode(mode fs.FileMode)
+}
+
+// WriteFile writes data as the whole content of the named file
+func WriteFile(store Storage, name string, data []byte) error {
+	w, err := store.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		_ = w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// CopyFile copies the named file of src into dstName of dst. Both may be the same storage.
+// The permission bits of the source are kept when dst supports them.
+func CopyFile(src Storage, srcName string, dst Storage, dstName string) error {
+	in, err := src.Open(srcName)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	w, err := dst.Create(dstName)
+	if err != nil {
+		return err
+	}
+	if m, ok := w.(modeSetter); ok {
+		m.SetMode(info.Mode())
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		_ = w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// CopyTree copies the named file or directory of src, with everything below it, into dstName of dst.
+func CopyTree(src Storage, srcName string, dst Storage, dstName string) error {
+	return fs.WalkDir(src, srcName, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := dstName
+		if p != srcName {
+			target = path.Join(dstName, p[len(srcName)+1:])
+			if srcName == "." {
+				target = path.Join(dstName, p)
+			}
+		}
+		if d.IsDir() {
+			return dst.MkdirAll(target, 0755)
+		}
+		return CopyFile(src, p, dst, target)
+	})
+}
+
+func pathError(op, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// RangeReader is implemented by storages able to read part of a file without fetching all of it
+type RangeReader interface {
+	// ReadRange reads up to length bytes of the named file, starting at offset
+	ReadRange(name string, offset, length int64) ([]byte, error)
+}
+
+// ReadRange reads up to length bytes of the named file starting at offset, using the storage's own
+// RangeReader when it has one and seeking into the opened file otherwise.
+func ReadRange(store Storage, name string, offset, length int64) ([]byte, error) {
+	if rr, ok := store.(RangeReader); ok {
+		return rr.ReadRange(name, offset, length)
+	}
+	f, err := store.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data := make([]byte, length)
+	var n int
+	switch r := f.(type) {
+	case io.ReaderAt:
+		n, err = r.ReadAt(data, offset)
+	case io.Seeker:
+		if _, err = r.Seek(offset, io.SeekStart); err == nil {
+			n, err = io.ReadFull(f, data)
+		}
+	default:
+		if _, err = io.CopyN(io.Discard, f, offset); err == nil {
+			n, err = io.ReadFull(f, data)
+		}
+	}
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return data[:n], nil
+}
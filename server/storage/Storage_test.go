@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStorages(t *testing.T) {
+	s3, _ := newFakeS3(t, "")
+	stores := map[string]Storage{
+		"local":  NewLocal(t.TempDir()),
+		"memory": NewMemory(),
+		"s3":     s3,
+	}
+	for kind, store := range stores {
+		t.Run(kind, func(t *testing.T) {
+			assert.NoError(t, store.MkdirAll("campaign/summer", 0755))
+			assert.NoError(t, store.Mkdir("brand", 0755))
+			assert.Error(t, store.Mkdir("missing/child", 0755))
+			assert.NoError(t, WriteFile(store, "campaign/summer/intro.mp4", []byte("intro")))
+			assert.NoError(t, WriteFile(store, "campaign/readme.txt", []byte("readme")))
+			assert.NoError(t, fstest.TestFS(store, "campaign/summer/intro.mp4", "campaign/readme.txt", "brand"))
+
+			w, err := store.Create("campaign/readme.txt")
+			assert.NoError(t, err)
+			_, err = w.Write([]byte("discarded"))
+			assert.NoError(t, err)
+			assert.NoError(t, w.Abort())
+			data, err := fs.ReadFile(store, "campaign/readme.txt")
+			assert.NoError(t, err)
+			assert.Equal(t, "readme", string(data))
+
+			assert.NoError(t, CopyTree(store, "campaign", store, "brand/copy"))
+			data, err = fs.ReadFile(store, "brand/copy/summer/intro.mp4")
+			assert.NoError(t, err)
+			assert.Equal(t, "intro", string(data))
+
+			assert.NoError(t, store.Rename("campaign/summer", "brand/summer"))
+			_, err = store.Stat("campaign/summer/intro.mp4")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+			info, err := store.Stat("brand/summer/intro.mp4")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(5), info.Size())
+
+			assert.Error(t, store.Remove("brand"))
+			assert.NoError(t, store.RemoveAll("brand"))
+			assert.NoError(t, store.RemoveAll("brand"))
+			entries, err := store.ReadDir(".")
+			assert.NoError(t, err)
+			assert.Len(t, entries, 1)
+
+			_, err = store.Open("../escape")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLocalFileModes(t *testing.T) {
+	root := t.TempDir()
+	store := NewLocal(root)
+	assert.NoError(t, WriteFile(store, "intro.mp4", []byte("intro")))
+	info, err := os.Stat(filepath.Join(root, "intro.mp4"))
+	assert.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0644), info.Mode().Perm())
+
+	assert.NoError(t, os.Chmod(filepath.Join(root, "intro.mp4"), 0640))
+	assert.NoError(t, CopyFile(store, "intro.mp4", store, "copy.mp4"))
+	info, err = os.Stat(filepath.Join(root, "copy.mp4"))
+	assert.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0640), info.Mode().Perm())
+}
@@ -0,0 +1,86 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/config"
+	"github.com/newm4n/Adverter/server/web/model"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"time"
+)
+
+// RequestIDHeader carries the ID of a request, kept from the client or proxy when it sent one
+const RequestIDHeader = "X-Request-ID"
+
+// accessLog writes one JSON line per request served, apart from the server log
+var accessLog = &log.Logger{
+	Out:       os.Stdout,
+	Formatter: &log.JSONFormatter{},
+	Hooks:     make(log.LevelHooks),
+	Level:     log.InfoLevel,
+}
+
+// Logged is a middleware giving every request an ID, echoed in the X-Request-ID response header and
+// carried by the request context so model.Logger tags the logs with it. When server.log.access is set
+// every request is logged to the access log: method, route, status, bytes, duration and client.
+func Logged(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		r = r.WithContext(model.WithRequestID(r.Context(), requestID))
+		if !config.GetBoolean("server.log.access") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		mw := &meteredWriter{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		defer func() {
+			accessLog.WithFields(log.Fields{
+				"requestId": requestID,
+				"method":    r.Method,
+				"route":     route,
+				"path":      r.URL.Path,
+				"status":    mw.status,
+				"bytes":     mw.written,
+				"duration":  time.Since(start).Seconds(),
+				"client":    clientIdentity(r),
+				"ip":        clientIP(r),
+			}).Info("request served")
+		}()
+		next.ServeHTTP(mw, r)
+	})
+}
+
+// validRequestID tells whether a request ID sent by a client is safe to log and echo back
+func validRequestID(requestID string) bool {
+	if len(requestID) == 0 || len(requestID) > 128 {
+		return false
+	}
+	for _, c := range requestID {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return hex.EncodeToString([]byte(time.Now().Format(time.RFC3339Nano)))
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,55 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/web/model"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestLogged(t *testing.T) {
+	out := &bytes.Buffer{}
+	accessLog.Out = out
+	defer func() { accessLog.Out = os.Stdout }()
+
+	var seen string
+	Router = mux.NewRouter()
+	Router.Use(Logged)
+	Router.HandleFunc("/path/{b64path}/files", func(w http.ResponseWriter, r *http.Request) {
+		seen = model.RequestIDOf(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}).Methods(http.MethodGet)
+
+	request, _ := http.NewRequest(http.MethodGet, "/path/a.b/files", nil)
+	request.Header.Set(RequestIDHeader, "edge-42")
+	response := httptest.NewRecorder()
+	Router.ServeHTTP(response, request)
+	assert.Equal(t, "edge-42", response.Header().Get(RequestIDHeader))
+	assert.Equal(t, "edge-42", seen)
+
+	entry := make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "edge-42", entry["requestId"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/path/{b64path}/files", entry["route"])
+	assert.Equal(t, float64(http.StatusTeapot), entry["status"])
+	assert.Equal(t, float64(15), entry["bytes"])
+	assert.Contains(t, entry, "duration")
+	assert.Contains(t, entry, "ip")
+
+	// generated when missing or unsafe to echo back
+	for _, sent := range []string{"", "bad id\n"} {
+		request, _ = http.NewRequest(http.MethodGet, "/path/a.b/files", nil)
+		request.Header.Set(RequestIDHeader, sent)
+		response = httptest.NewRecorder()
+		Router.ServeHTTP(response, request)
+		assert.Len(t, response.Header().Get(RequestIDHeader), 32)
+		assert.Equal(t, response.Header().Get(RequestIDHeader), seen)
+	}
+}
@@ -0,0 +1,173 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/newm4n/Adverter/server/config"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type contextKey string
+
+const (
+	// ClaimsContextKey is the request context key of the verified token claims
+	ClaimsContextKey contextKey = "claims"
+)
+
+// TokenClaims are the registered JWT claims this server cares about
+type TokenClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+	IssuedAt  int64  `json:"iat"`
+}
+
+var tokenAlgorithms = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+// MinTokenKeyLength is the shortest token.crypt.key accepted to sign tokens
+const MinTokenKeyLength = 32
+
+// tokenKey returns token.crypt.key, refusing the public default key and keys too short to resist guessing
+func tokenKey() ([]byte, error) {
+	key := config.Get("token.crypt.key")
+	if key == config.DefaultTokenKey {
+		return nil, fmt.Errorf("token.crypt.key is the default key, it must be changed")
+	}
+	if len(key) < MinTokenKeyLength {
+		return nil, fmt.Errorf("token.crypt.key is shorter than %d characters", MinTokenKeyLength)
+	}
+	return []byte(key), nil
+}
+
+// Authenticated wraps a handler so it is only served to requests bearing a valid access token
+// signed with token.crypt.key and issued by token.issuer. The verified claims are put into the
+// request context under ClaimsContextKey.
+func Authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !config.GetBoolean("server.auth.enable") {
+			next(w, r)
+			return
+		}
+		authHeader := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "unauthorized", "missing bearer token")
+			return
+		}
+		claims, err := VerifyToken(strings.TrimSpace(authHeader[len("Bearer "):]))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer error=\"invalid_token\"")
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "unauthorized", fmt.Sprintf("invalid token. got %s", err.Error()))
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), ClaimsContextKey, claims)))
+	}
+}
+
+// ClaimsOf returns the verified token claims of an authenticated request, or nil
+func ClaimsOf(r *http.Request) *TokenClaims {
+	claims, _ := r.Context().Value(ClaimsContextKey).(*TokenClaims)
+	return claims
+}
+
+// VerifyToken checks the signature, issuer and validity period of a JWT
+func VerifyToken(token string) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token header")
+	}
+	header := struct {
+		Alg string `json:"alg"`
+	}{}
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, fmt.Errorf("malformed token header")
+	}
+	if header.Alg != config.Get("token.crypt.method") {
+		return nil, fmt.Errorf("unexpected signing method %s", header.Alg)
+	}
+	newHash, ok := tokenAlgorithms[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signing method %s", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature")
+	}
+	key, err := tokenKey()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(newHash, key)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+
+	claimBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token claims")
+	}
+	claims := &TokenClaims{}
+	if err := json.Unmarshal(claimBytes, claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims")
+	}
+	now := time.Now().Unix()
+	if claims.ExpiresAt == 0 || now >= claims.ExpiresAt {
+		return nil, fmt.Errorf("token expired")
+	}
+	if claims.NotBefore != 0 && now < claims.NotBefore {
+		return nil, fmt.Errorf("token not valid yet")
+	}
+	if claims.Issuer != config.Get("token.issuer") {
+		return nil, fmt.Errorf("unexpected issuer %s", claims.Issuer)
+	}
+	return claims, nil
+}
+
+// SignToken issues a JWT for subject, valid for duration, signed the same way VerifyToken expects.
+func SignToken(subject string, duration time.Duration) (string, error) {
+	method := config.Get("token.crypt.method")
+	newHash, ok := tokenAlgorithms[method]
+	if !ok {
+		return "", fmt.Errorf("unsupported signing method %s", method)
+	}
+	headerBytes, err := json.Marshal(map[string]string{"alg": method, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claimBytes, err := json.Marshal(&TokenClaims{
+		Issuer:    config.Get("token.issuer"),
+		Subject:   subject,
+		ExpiresAt: now.Add(duration).Unix(),
+		IssuedAt:  now.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	key, err := tokenKey()
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(headerBytes) + "." + base64.RawURLEncoding.EncodeToString(claimBytes)
+	mac := hmac.New(newHash, key)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,80 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"github.com/newm4n/Adverter/server/config"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTokenKey sets a token.crypt.key fit for signing, restoring the default when the test ends
+func useTokenKey(t *testing.T) {
+	config.Set("token.crypt.key", "a-test-key-long-enough-to-sign-tokens")
+	t.Cleanup(func() { config.Set("token.crypt.key", config.DefaultTokenKey) })
+}
+
+func TestAuthenticated(t *testing.T) {
+	useTokenKey(t)
+	handler := Authenticated(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ClaimsOf(r).Subject))
+	})
+	call := func(authorization string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodPost, "/path/x/mkdir", nil)
+		if len(authorization) > 0 {
+			request.Header.Set("Authorization", authorization)
+		}
+		response := httptest.NewRecorder()
+		handler(response, request)
+		return response
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, call("").Code)
+
+	token, err := SignToken("operator", time.Minute)
+	assert.NoError(t, err)
+	response := call("Bearer " + token)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "operator", response.Body.String())
+
+	tampered := token[:strings.LastIndex(token, ".")] + ".AAAA"
+	assert.Equal(t, http.StatusUnauthorized, call("Bearer "+tampered).Code)
+
+	expired, err := SignToken("operator", -time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, call("Bearer "+expired).Code)
+}
+
+func TestDefaultTokenKeyRejected(t *testing.T) {
+	handler := Authenticated(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ClaimsOf(r).Subject))
+	})
+	// anyone can sign with the key published in the default configuration
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS512","typ":"JWT"}`))
+	claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"iss":%q,"sub":"intruder","exp":%d}`,
+		config.Get("token.issuer"), time.Now().Add(time.Hour).Unix())))
+	mac := hmac.New(sha512.New, []byte(config.DefaultTokenKey))
+	mac.Write([]byte(header + "." + claims))
+	forged := header + "." + claims + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	request, _ := http.NewRequest(http.MethodPost, "/path/x/mkdir", nil)
+	request.Header.Set("Authorization", "Bearer "+forged)
+	response := httptest.NewRecorder()
+	handler(response, request)
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+	_, err := SignToken("operator", time.Minute)
+	assert.Error(t, err)
+	assert.Error(t, ValidateConfig())
+
+	config.Set("token.crypt.key", "short")
+	defer config.Set("token.crypt.key", config.DefaultTokenKey)
+	assert.Error(t, ValidateConfig())
+	config.Set("token.crypt.key", "a-test-key-long-enough-to-sign-tokens")
+	assert.NoError(t, ValidateConfig())
+}
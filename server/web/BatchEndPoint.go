@@ -0,0 +1,164 @@
+package web
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/config"
+	"github.com/newm4n/Adverter/server/web/model"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ChunkBatchContentType is the length prefixed stream of chunks answered by GetChunkBatch. Every chunk is
+	// framed as its index (4 bytes), the MD5 of its bytes (16 bytes) and its length (4 bytes), all big endian,
+	// followed by its bytes.
+	ChunkBatchContentType = "application/x-adverter-chunks"
+	// ChunkBatchFrameSize is the size of the frame in front of every chunk of a ChunkBatchContentType stream
+	ChunkBatchFrameSize = 4 + 16 + 4
+
+	batchBufferSize = 64 * 1024
+)
+
+// Router.Handle("/path/{b64path}/chunk/batch", GetChunkBatch)
+// The chunks query parameter lists the chunks to send, by index or range, eg. "0,3,5-9". The response is a
+// ChunkBatchContentType stream, or multipart/mixed with X-Chunk-Index and X-Chunk-Hash part headers when the
+// request accepts multipart/mixed. The chunking query parameter selects fixed (default) or cdc chunks.
+func GetChunkBatch(w http.ResponseWriter, r *http.Request) {
+	varMap := mux.Vars(r)
+	b64Path := varMap["b64path"]
+	pathInfo, err := model.NewPathInfoFromBase64(b64Path)
+	if err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	chunking, err := model.ParseChunking(r.URL.Query().Get("chunking"))
+	if err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	tFile, err := model.NewTheFile(pathInfo.Path)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	tFile.WithContext(r.Context())
+	var manifest *model.ChunkManifest
+	chunkCount := tFile.GetChunkCount()
+	if chunking == model.ChunkingCDC {
+		if manifest, err = model.ManifestOf(tFile, chunking); err != nil {
+			writeModelError(w, r, err)
+			return
+		}
+		chunkCount = len(manifest.Chunks)
+	}
+	chunkNos, err := parseChunkList(r.URL.Query().Get("chunks"), chunkCount, config.GetInt("server.chunk.batch.max"))
+	if err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	readChunk := func(chunkNo int) ([]byte, string, error) {
+		if manifest != nil {
+			return tFile.ChunkBytes(manifest.Chunks[chunkNo])
+		}
+		return tFile.GetByteOfChunk(chunkNo)
+	}
+
+	if IsCompressedMedia(tFile.Name) {
+		SkipCompression(w)
+	}
+	if strings.Contains(r.Header.Get("Accept"), "multipart/mixed") {
+		writeMultipartBatch(w, r, chunkNos, readChunk, tFile.FilePath)
+		return
+	}
+	w.Header().Set("Content-Type", ChunkBatchContentType)
+	w.WriteHeader(http.StatusOK)
+	// buffered so the frames do not go out in tiny writes, which Compressed would not compress
+	out := bufio.NewWriterSize(w, batchBufferSize)
+	defer out.Flush()
+	frame := make([]byte, ChunkBatchFrameSize)
+	for _, chunkNo := range chunkNos {
+		byts, hash, err := readChunk(chunkNo)
+		if err != nil {
+			// too late for an error status, the client sees the stream end early
+			model.Logger(r.Context()).Errorf("can not read chunk %d of %s. got %s", chunkNo, tFile.FilePath, err.Error())
+			return
+		}
+		binary.BigEndian.PutUint32(frame[0:4], uint32(chunkNo))
+		hex.Decode(frame[4:20], []byte(hash))
+		binary.BigEndian.PutUint32(frame[20:24], uint32(len(byts)))
+		if _, err := out.Write(frame); err != nil {
+			return
+		}
+		if _, err := out.Write(byts); err != nil {
+			return
+		}
+	}
+}
+
+func writeMultipartBatch(w http.ResponseWriter, r *http.Request, chunkNos []int, readChunk func(chunkNo int) ([]byte, string, error), filePath string) {
+	out := bufio.NewWriterSize(w, batchBufferSize)
+	defer out.Flush()
+	mw := multipart.NewWriter(out)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusOK)
+	for _, chunkNo := range chunkNos {
+		byts, hash, err := readChunk(chunkNo)
+		if err != nil {
+			model.Logger(r.Context()).Errorf("can not read chunk %d of %s. got %s", chunkNo, filePath, err.Error())
+			return
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":   {"application/octet-stream"},
+			"Content-Length": {strconv.Itoa(len(byts))},
+			"X-Chunk-Index":  {strconv.Itoa(chunkNo)},
+			"X-Chunk-Hash":   {hash},
+		})
+		if err != nil {
+			return
+		}
+		if _, err := part.Write(byts); err != nil {
+			return
+		}
+	}
+	mw.Close()
+}
+
+// parseChunkList reads a list of chunk indexes and ranges, eg. "0,3,5-9", every chunk below count.
+// At most max chunks may be listed, when max is positive.
+func parseChunkList(spec string, count, max int) ([]int, error) {
+	if len(strings.TrimSpace(spec)) == 0 {
+		return nil, fmt.Errorf("no chunks listed")
+	}
+	chunkNos := make([]int, 0)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		from, to, isRange := strings.Cut(item, "-")
+		first, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk %s", item)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(to); err != nil || last < first {
+				return nil, fmt.Errorf("invalid chunk range %s", item)
+			}
+		}
+		if first < 0 || last >= count {
+			return nil, fmt.Errorf("chunk %s out of range, the file has %d chunks", item, count)
+		}
+		if max > 0 && len(chunkNos)+last-first+1 > max {
+			return nil, fmt.Errorf("more than %d chunks asked", max)
+		}
+		for chunkNo := first; chunkNo <= last; chunkNo++ {
+			chunkNos = append(chunkNos, chunkNo)
+		}
+	}
+	return chunkNos, nil
+}
@@ -0,0 +1,58 @@
+package web
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/web/model"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"math/rand"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestGetChunkBatchMultipart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "intro.mp4")
+	content := make([]byte, 3*model.DefaultChunkSize+10)
+	rand.New(rand.NewSource(1)).Read(content)
+	assert.NoError(t, os.WriteFile(path, content, 0644))
+
+	Router = mux.NewRouter()
+	Router.HandleFunc("/path/{b64path}/chunk/batch", GetChunkBatch).Methods(http.MethodGet)
+	pi := model.PathInfo{Path: path}
+	request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/path/%s/chunk/batch?chunks=1-3", pi.ToPathInfoString()), nil)
+	request.Header.Set("Accept", "multipart/mixed")
+	response := httptest.NewRecorder()
+	Router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	_, params, err := mime.ParseMediaType(response.Header().Get("Content-Type"))
+	assert.NoError(t, err)
+	reader := multipart.NewReader(response.Body, params["boundary"])
+	for chunkNo := 1; chunkNo <= 3; chunkNo++ {
+		part, err := reader.NextPart()
+		assert.NoError(t, err)
+		assert.Equal(t, strconv.Itoa(chunkNo), part.Header.Get("X-Chunk-Index"))
+		data, err := io.ReadAll(part)
+		assert.NoError(t, err)
+		end := (chunkNo + 1) * model.DefaultChunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		assert.Equal(t, content[chunkNo*model.DefaultChunkSize:end], data)
+		assert.Equal(t, model.MD5OfBytes(data), part.Header.Get("X-Chunk-Hash"))
+	}
+	_, err = reader.NextPart()
+	assert.Equal(t, io.EOF, err)
+
+	request, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/path/%s/chunk/batch?chunks=2-4", pi.ToPathInfoString()), nil)
+	response = httptest.NewRecorder()
+	Router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
@@ -0,0 +1,50 @@
+package web
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/web/model"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+var bundleContentTypes = map[model.BundleFormat]string{
+	model.BundleZip:   "application/zip",
+	model.BundleTar:   "application/x-tar",
+	model.BundleTarGz: "application/gzip",
+}
+
+// Router.Handle("/path/{b64path}/bundle", GetBundle)
+// Streams the whole directory tree as an archive, the format query parameter selecting zip (default), tar
+// or tar.gz. The last entry of the archive is model.BundleManifestName, listing the hash of every file.
+func GetBundle(w http.ResponseWriter, r *http.Request) {
+	varMap := mux.Vars(r)
+	b64Path := varMap["b64path"]
+	pathInfo, err := model.NewPathInfoFromBase64(b64Path)
+	if err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	format, err := model.ParseBundleFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	tDir, err := model.NewTheDirectory(pathInfo.Path)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	tDir.WithContext(r.Context())
+
+	// a bundle takes longer than server.timeout.write to stream
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", bundleContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(tDir.DirPath)+"."+string(format)))
+	w.WriteHeader(http.StatusOK)
+	if _, err := model.WriteBundle(w, tDir, format); err != nil {
+		// too late for an error status, the client is left with a truncated archive
+		model.Logger(r.Context()).Errorf("can not bundle %s. got %s", tDir.DirPath, err.Error())
+	}
+}
@@ -0,0 +1,47 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/web/model"
+	"net/http"
+)
+
+// Router.Handle("/chunks/{hash}", GetChunkByHash)
+// Serves a chunk from any file of the library holding it, whatever chunking the client used to learn its hash.
+func GetChunkByHash(w http.ResponseWriter, r *http.Request) {
+	if model.Chunks == nil {
+		writeError(w, r, http.StatusServiceUnavailable, CodeUnavailable, "chunk index is not available", "")
+		return
+	}
+	hash := mux.Vars(r)["hash"]
+	byts, err := model.Chunks.Read(hash)
+	if errors.Is(err, model.ErrChunkNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "not found", fmt.Sprintf("no chunk %s", hash))
+		return
+	}
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+
+	if locations := model.Chunks.Locate(hash); len(locations) > 0 && IsCompressedMedia(locations[0].Path) {
+		SkipCompression(w)
+	}
+	retBytes, err := json.Marshal(&ChunkInfoRespond{
+		Base64: base64.StdEncoding.EncodeToString(byts),
+		Hash:   hash,
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// a chunk never changes once named by its hash
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+	w.Write(retBytes)
+}
@@ -0,0 +1,208 @@
+package web
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"github.com/newm4n/Adverter/server/config"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Encoder compresses everything written to the returned writer into w
+type Encoder func(w io.Writer) (io.WriteCloser, error)
+
+var (
+	encoders = map[string]Encoder{
+		"gzip": func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+		},
+		"deflate": func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, flate.DefaultCompression)
+		},
+	}
+	// encodingPreference orders the encodings a client accepts with the same quality
+	encodingPreference = []string{"zstd", "br", "gzip", "deflate"}
+	encodersMutex      sync.RWMutex
+
+	// compressedExts are media already compressed by their format, compressing them again only costs time
+	compressedExts = map[string]bool{
+		"mp4": true, "m4v": true, "mov": true, "webm": true, "mkv": true, "avi": true,
+		"mp3": true, "m4a": true, "aac": true, "ogg": true, "opus": true, "flac": true,
+		"jpg": true, "jpeg": true, "png": true, "gif": true, "webp": true, "avif": true, "heic": true,
+		"zip": true, "gz": true, "tgz": true, "bz2": true, "xz": true, "zst": true, "7z": true, "rar": true,
+		"woff": true, "woff2": true, "pdf": true,
+	}
+)
+
+// RegisterEncoding makes Compressed offer an encoding, eg. "zstd" backed by a zstd library,
+// on top of the built in gzip and deflate
+func RegisterEncoding(name string, encoder Encoder) {
+	encodersMutex.Lock()
+	defer encodersMutex.Unlock()
+	encoders[name] = encoder
+}
+
+// IsCompressedMedia tells whether the file name is of a media type already compressed by its format
+func IsCompressedMedia(name string) bool {
+	return compressedExts[strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))]
+}
+
+// NegotiateEncoding picks the encoding of the response from the request Accept-Encoding header,
+// the empty string meaning identity
+func NegotiateEncoding(acceptEncoding string) string {
+	encodersMutex.RLock()
+	defer encodersMutex.RUnlock()
+	quality := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if name == "*" {
+			wildcard = q
+		} else if len(name) > 0 {
+			quality[name] = q
+		}
+	}
+	candidates := make([]string, 0)
+	for _, name := range encodingPreference {
+		if _, ok := encoders[name]; !ok {
+			continue
+		}
+		if q, ok := quality[name]; (ok && q > 0) || (!ok && wildcard > 0) {
+			candidates = append(candidates, name)
+		}
+	}
+	qualityOf := func(name string) float64 {
+		if q, ok := quality[name]; ok {
+			return q
+		}
+		return wildcard
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return qualityOf(candidates[i]) > qualityOf(candidates[j])
+	})
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[0]
+}
+
+// SkipCompression tells Compressed to send this response as is, for bodies holding already compressed media
+func SkipCompression(w http.ResponseWriter) {
+	if cw, ok := w.(*compressWriter); ok {
+		cw.skip = true
+	}
+}
+
+// Compressed wraps a handler so its response is compressed with the encoding negotiated from Accept-Encoding.
+// Responses smaller than server.http.compression.minsize, or marked with SkipCompression, are sent as is.
+func Compressed(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !config.GetBoolean("server.http.compression.enable") {
+			next(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := NegotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if len(encoding) == 0 {
+			next(w, r)
+			return
+		}
+		encodersMutex.RLock()
+		encoder := encoders[encoding]
+		encodersMutex.RUnlock()
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			encoder:        encoder,
+			minSize:        config.GetInt("server.http.compression.minsize"),
+			status:         http.StatusOK,
+		}
+		defer cw.Close()
+		next(cw, r)
+	}
+}
+
+// compressWriter holds the status back until the first write, where it knows whether to compress
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	encoder     Encoder
+	minSize     int
+	skip        bool
+	status      int
+	wroteHeader bool
+	started     bool
+	out         io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.started {
+		cw.start(len(p))
+	}
+	if cw.out != nil {
+		return cw.out.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *compressWriter) start(firstWrite int) {
+	cw.started = true
+	header := cw.Header()
+	compress := !cw.skip && firstWrite >= cw.minSize && len(header.Get("Content-Encoding")) == 0 &&
+		cw.status != http.StatusNoContent && cw.status != http.StatusNotModified
+	if compress {
+		out, err := cw.encoder(cw.ResponseWriter)
+		if err == nil {
+			cw.out = out
+			header.Set("Content-Encoding", cw.encoding)
+			header.Del("Content-Length")
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+// Close flushes the compressed stream, or the status of a response without body
+func (cw *compressWriter) Close() error {
+	if !cw.started {
+		if cw.wroteHeader {
+			cw.started = true
+			cw.ResponseWriter.WriteHeader(cw.status)
+		}
+		return nil
+	}
+	if cw.out != nil {
+		return cw.out.Close()
+	}
+	return nil
+}
+
+func (cw *compressWriter) Flush() {
+	if cw.out != nil {
+		if flusher, ok := cw.out.(interface{ Flush() error }); ok {
+			_ = flusher.Flush()
+		}
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
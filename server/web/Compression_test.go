@@ -0,0 +1,58 @@
+package web
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/web/model"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "", NegotiateEncoding(""))
+	assert.Equal(t, "gzip", NegotiateEncoding("gzip, deflate"))
+	assert.Equal(t, "deflate", NegotiateEncoding("gzip;q=0.5, deflate"))
+	assert.Equal(t, "deflate", NegotiateEncoding("gzip;q=0, *"))
+	assert.Equal(t, "", NegotiateEncoding("br, identity"))
+	assert.Equal(t, "gzip", NegotiateEncoding("zstd, gzip"))
+}
+
+func TestCompressed(t *testing.T) {
+	dir := t.TempDir()
+	text := []byte(strings.Repeat("<svg><rect width=\"10\" height=\"10\"/></svg>\n", 1000))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "banner.svg"), text, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "intro.mp4"), text, 0644))
+
+	Router = mux.NewRouter()
+	Router.HandleFunc("/path/{b64path}/chunk/{chunkno}", Compressed(GetChunkData)).Methods(http.MethodGet)
+
+	get := func(name string) *httptest.ResponseRecorder {
+		pi := model.PathInfo{Path: filepath.Join(dir, name)}
+		request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/path/%s/chunk/0", pi.ToPathInfoString()), nil)
+		request.Header.Set("Accept-Encoding", "gzip")
+		response := httptest.NewRecorder()
+		Router.ServeHTTP(response, request)
+		assert.Equal(t, http.StatusOK, response.Code)
+		return response
+	}
+
+	response := get("banner.svg")
+	assert.Equal(t, "gzip", response.Header().Get("Content-Encoding"))
+	assert.Less(t, response.Body.Len(), len(text)/4)
+	gz, err := gzip.NewReader(response.Body)
+	assert.NoError(t, err)
+	body, err := io.ReadAll(gz)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), model.MD5OfBytes(text))
+
+	response = get("intro.mp4")
+	assert.Empty(t, response.Header().Get("Content-Encoding"))
+	assert.Contains(t, response.Body.String(), model.MD5OfBytes(text))
+}
@@ -27,7 +27,10 @@ type FileInfoRespond struct {
 	Name       string
 	Path       string
 	ParentPath string
+	Chunking   string
 	ChunkCount int
+	ChunkSize  int
+	Size       int64
 	FileHash   string
 }
 
@@ -37,20 +40,18 @@ func ListFiles(w http.ResponseWriter, r *http.Request) {
 	b64Path := varMap["b64path"]
 	pathInfo, err := model.NewPathInfoFromBase64(b64Path)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeInvalidParam(w, r, err)
 		return
 	}
 	tDir, err := model.NewTheDirectory(pathInfo.Path)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeModelError(w, r, err)
 		return
 	}
+	tDir.WithContext(r.Context())
 	files, err := tDir.ListFiles()
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeModelError(w, r, err)
 		return
 	}
 	ret := make([]*DirItemRespond, 0)
@@ -67,8 +68,7 @@ func ListFiles(w http.ResponseWriter, r *http.Request) {
 	}
 	retBytes, err := json.Marshal(ret)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeInternalError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -82,20 +82,18 @@ func ListDirectories(w http.ResponseWriter, r *http.Request) {
 	b64Path := varMap["b64path"]
 	pathInfo, err := model.NewPathInfoFromBase64(b64Path)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeInvalidParam(w, r, err)
 		return
 	}
 	tDir, err := model.NewTheDirectory(pathInfo.Path)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeModelError(w, r, err)
 		return
 	}
+	tDir.WithContext(r.Context())
 	dirs, err := tDir.ListDirectories()
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeModelError(w, r, err)
 		return
 	}
 	ret := make([]*DirItemRespond, 0)
@@ -112,8 +110,7 @@ func ListDirectories(w http.ResponseWriter, r *http.Request) {
 	}
 	retBytes, err := json.Marshal(ret)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeInternalError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -127,14 +124,17 @@ func GetChunkInfo(w http.ResponseWriter, r *http.Request) {
 	b64Path := varMap["b64path"]
 	pathInfo, err := model.NewPathInfoFromBase64(b64Path)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeInvalidParam(w, r, err)
+		return
+	}
+	chunking, err := model.ParseChunking(r.URL.Query().Get("chunking"))
+	if err != nil {
+		writeInvalidParam(w, r, err)
 		return
 	}
 	fileFile, err := model.NewTheFile(pathInfo.Path)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeModelError(w, r, err)
 		return
 	}
 
@@ -142,14 +142,13 @@ func GetChunkInfo(w http.ResponseWriter, r *http.Request) {
 
 	tFile, err := model.NewTheFile(fileFile.FilePath)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeModelError(w, r, err)
 		return
 	}
+	tFile.WithContext(r.Context())
 	hash, err := tFile.GetHash()
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeModelError(w, r, err)
 		return
 	}
 
@@ -157,14 +156,25 @@ func GetChunkInfo(w http.ResponseWriter, r *http.Request) {
 		Name:       pathInfo.Path[lIdx+1:],
 		ParentPath: pathInfo.Path[:lIdx],
 		Path:       pathInfo.Path,
+		Chunking:   string(chunking),
 		ChunkCount: tFile.GetChunkCount(),
+		ChunkSize:  tFile.GetChunkSize(),
+		Size:       tFile.GetSize(),
 		FileHash:   hash,
 	}
+	if chunking == model.ChunkingCDC {
+		manifest, err := model.ManifestOf(tFile, chunking)
+		if err != nil {
+			writeModelError(w, r, err)
+			return
+		}
+		infoResponse.ChunkCount = len(manifest.Chunks)
+		infoResponse.ChunkSize = manifest.ChunkSize
+	}
 
 	retBytes, err := json.Marshal(infoResponse)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeInternalError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -173,6 +183,7 @@ func GetChunkInfo(w http.ResponseWriter, r *http.Request) {
 }
 
 // Router.Handle("/path/{b64path}/chunk/{chunkno}", GetChunkData)
+// chunkno is the index or the hash of the chunk, the chunking query parameter selects fixed (default) or cdc chunks.
 func GetChunkData(w http.ResponseWriter, r *http.Request) {
 	varMap := mux.Vars(r)
 	b64Path := varMap["b64path"]
@@ -180,32 +191,38 @@ func GetChunkData(w http.ResponseWriter, r *http.Request) {
 
 	pathInfo, err := model.NewPathInfoFromBase64(b64Path)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeInvalidParam(w, r, err)
 		return
 	}
 
-	chunkNo, err := strconv.Atoi(chunkNoStr)
+	chunking, err := model.ParseChunking(r.URL.Query().Get("chunking"))
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeInvalidParam(w, r, err)
 		return
 	}
 
 	tFile, err := model.NewTheFile(pathInfo.Path)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeModelError(w, r, err)
 		return
 	}
+	tFile.WithContext(r.Context())
 
-	byts, hash, err := tFile.GetByteOfChunk(chunkNo)
+	var byts []byte
+	var hash string
+	if chunkNo, numErr := strconv.Atoi(chunkNoStr); numErr == nil && chunking == model.ChunkingFixed {
+		byts, hash, err = tFile.GetByteOfChunk(chunkNo)
+	} else {
+		byts, hash, err = chunkOf(tFile, chunkNoStr, chunking)
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeModelError(w, r, err)
 		return
 	}
 
+	if IsCompressedMedia(tFile.Name) {
+		SkipCompression(w)
+	}
 	cresp := &ChunkInfoRespond{
 		Base64: base64.StdEncoding.EncodeToString(byts),
 		Hash:   hash,
@@ -213,11 +230,24 @@ func GetChunkData(w http.ResponseWriter, r *http.Request) {
 
 	retBytes, err := json.Marshal(cresp)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("invalid param. got %s", err.Error())))
+		writeInternalError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(retBytes)
 }
+
+// chunkOf reads the chunk of tFile identified by its index or its hash in the manifest made the chunking way
+func chunkOf(tFile *model.TheFile, id string, chunking model.Chunking) ([]byte, string, error) {
+	manifest, err := model.ManifestOf(tFile, chunking)
+	if err != nil {
+		return nil, "", err
+	}
+	chunk, ok := manifest.Chunk(id)
+	if !ok {
+		return nil, "", &model.PathError{Path: tFile.FilePath, Kind: model.ErrChunkOutOfRange,
+			Err: fmt.Errorf("no chunk %s, the file has %d chunks", id, len(manifest.Chunks))}
+	}
+	return tFile.ChunkBytes(chunk)
+}
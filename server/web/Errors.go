@@ -0,0 +1,83 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/newm4n/Adverter/server/web/model"
+	"io/fs"
+	"net/http"
+)
+
+// Error codes of ErrorRespond
+const (
+	CodeInvalidParam     = "INVALID_PARAM"
+	CodeNotFound         = "NOT_FOUND"
+	CodeUnauthorized     = "UNAUTHORIZED"
+	CodeForbidden        = "FORBIDDEN"
+	CodeConflict         = "CONFLICT"
+	CodeChunkOutOfRange  = "CHUNK_OUT_OF_RANGE"
+	CodeRangeOutOfBounds = "RANGE_OUT_OF_BOUNDS"
+	CodeChecksumMismatch = "CHECKSUM_MISMATCH"
+	CodeTooLarge         = "TOO_LARGE"
+	CodeTooManyRequests  = "TOO_MANY_REQUESTS"
+	CodeUnsupported      = "UNSUPPORTED"
+	CodeInternal         = "INTERNAL"
+	CodeUnavailable      = "UNAVAILABLE"
+)
+
+// ErrorRespond is the body of every error response, RequestID matching the X-Request-ID response header
+type ErrorRespond struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   string `json:"details,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// writeError answers status with an ErrorRespond
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message, details string) {
+	retBytes, _ := json.Marshal(&ErrorRespond{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: model.RequestIDOf(r.Context()),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(retBytes)
+}
+
+// writeInvalidParam answers 400 to a request with a malformed parameter
+func writeInvalidParam(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, http.StatusBadRequest, CodeInvalidParam, "invalid param", err.Error())
+}
+
+// writeModelError answers the status matching the kind of a model error: 400 for invalid requests,
+// 404 for missing paths and chunks, 403 for denied paths, 409 for taken paths, 413 for requests above
+// a size limit, 416 for chunks and byte ranges out of the file and 500 otherwise, logged as its details are not sent. Storage errors are
+// told apart the same way by their io/fs kind.
+func writeModelError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, model.ErrInvalid), errors.Is(err, fs.ErrInvalid):
+		writeInvalidParam(w, r, err)
+	case errors.Is(err, model.ErrNotFound), errors.Is(err, model.ErrChunkNotFound), errors.Is(err, fs.ErrNotExist):
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "not found", err.Error())
+	case errors.Is(err, model.ErrDenied), errors.Is(err, fs.ErrPermission):
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "access denied", err.Error())
+	case errors.Is(err, model.ErrTooLarge):
+		writeError(w, r, http.StatusRequestEntityTooLarge, CodeTooLarge, "too large", err.Error())
+	case errors.Is(err, model.ErrExist), errors.Is(err, fs.ErrExist):
+		writeError(w, r, http.StatusConflict, CodeConflict, "already exist", err.Error())
+	case errors.Is(err, model.ErrChunkOutOfRange):
+		writeError(w, r, http.StatusRequestedRangeNotSatisfiable, CodeChunkOutOfRange, "chunk out of range", err.Error())
+	case errors.Is(err, model.ErrRangeOutOfBounds):
+		writeError(w, r, http.StatusRequestedRangeNotSatisfiable, CodeRangeOutOfBounds, "byte range out of bounds", err.Error())
+	default:
+		writeInternalError(w, r, err)
+	}
+}
+
+// writeInternalError answers 500, logging err with the request ID
+func writeInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	model.Logger(r.Context()).Errorf("can not serve %s %s. got %s", r.Method, r.URL.Path, err.Error())
+	writeError(w, r, http.StatusInternalServerError, CodeInternal, "internal error", "")
+}
@@ -0,0 +1,121 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/web/model"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestErrorEnvelope(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "intro.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("hello"), 0644))
+
+	Router = mux.NewRouter()
+	Router.Use(Logged)
+	Router.HandleFunc("/path/{b64path}/files", ListFiles).Methods(http.MethodGet)
+	Router.HandleFunc("/path/{b64path}/chunk/{chunkno}", GetChunkData).Methods(http.MethodGet)
+
+	errorOf := func(url string) (int, *ErrorRespond) {
+		request, _ := http.NewRequest(http.MethodGet, url, nil)
+		request.Header.Set(RequestIDHeader, "req-1")
+		response := httptest.NewRecorder()
+		Router.ServeHTTP(response, request)
+		assert.Equal(t, "application/json", response.Header().Get("Content-Type"))
+		ret := &ErrorRespond{}
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), ret))
+		assert.Equal(t, "req-1", ret.RequestID)
+		return response.Code, ret
+	}
+
+	code, ret := errorOf("/path/not-base64!/files")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, CodeInvalidParam, ret.Code)
+
+	missing := model.PathInfo{Path: filepath.Join(dir, "missing")}
+	code, ret = errorOf(fmt.Sprintf("/path/%s/files", missing.ToPathInfoString()))
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, CodeNotFound, ret.Code)
+
+	pi := model.PathInfo{Path: path}
+	code, ret = errorOf(fmt.Sprintf("/path/%s/chunk/7?chunking=cdc", pi.ToPathInfoString()))
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, code)
+	assert.Equal(t, CodeChunkOutOfRange, ret.Code)
+}
+
+func TestWriteModelError(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	for err, status := range map[error]int{
+		&model.PathError{Path: "/a", Kind: model.ErrDenied, Err: fs.ErrPermission}: http.StatusForbidden,
+		&model.PathError{Path: "/a", Kind: model.ErrNotFound, Err: fs.ErrNotExist}: http.StatusNotFound,
+		fmt.Errorf("hash %s. got %w", "/a", model.ErrChunkNotFound):                http.StatusNotFound,
+		fmt.Errorf("/a already exist. got %w", model.ErrExist):                     http.StatusConflict,
+		&fs.PathError{Op: "mkdir", Path: "/a", Err: fs.ErrExist}:                   http.StatusConflict,
+		fmt.Errorf("invalid name %q. got %w", "..", model.ErrInvalid):              http.StatusBadRequest,
+		fmt.Errorf("disk on fire"):                                                 http.StatusInternalServerError,
+	} {
+		response := httptest.NewRecorder()
+		writeModelError(response, request, err)
+		assert.Equal(t, status, response.Code, err.Error())
+	}
+	response := httptest.NewRecorder()
+	writeModelError(response, request, fmt.Errorf("disk on fire"))
+	assert.NotContains(t, response.Body.String(), "disk on fire")
+}
+
+func TestEndpointErrorEnvelope(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "intro.txt"), []byte("hello"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "outro.txt"), []byte("bye"), 0644))
+	model.Library = model.NewMediaIndex(root)
+	defer func() { model.Library = nil }()
+
+	Router = mux.NewRouter()
+	Router.HandleFunc("/path/{b64path}/mkdir", CreateDirectory).Methods(http.MethodPost)
+	Router.HandleFunc("/path/{b64path}/rename", RenameItem).Methods(http.MethodPost)
+	Router.HandleFunc("/path/{b64path}/chunk/manifest", GetChunkManifest).Methods(http.MethodGet)
+	Router.HandleFunc("/upload/{uploadid}", GetUpload).Methods(http.MethodGet)
+	Router.HandleFunc("/trash/{trashid}", PurgeTrashItem).Methods(http.MethodDelete)
+
+	errorOf := func(method, path, body string) (int, *ErrorRespond) {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		response := httptest.NewRecorder()
+		Router.ServeHTTP(response, request)
+		assert.Equal(t, "application/json", response.Header().Get("Content-Type"), path)
+		ret := &ErrorRespond{}
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), ret), path)
+		return response.Code, ret
+	}
+	urlOf := func(path, endpoint string) string {
+		pi := model.PathInfo{Path: path}
+		return fmt.Sprintf("/path/%s/%s", pi.ToPathInfoString(), endpoint)
+	}
+
+	code, ret := errorOf(http.MethodPost, urlOf(root, "mkdir"), `{"Name":".."}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, CodeInvalidParam, ret.Code)
+	code, ret = errorOf(http.MethodPost, urlOf(filepath.Join(root, "intro.txt"), "rename"), `{"Name":"outro.txt"}`)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, CodeConflict, ret.Code)
+	code, ret = errorOf(http.MethodPost, urlOf(filepath.Dir(root), "rename"), `{"Name":"elsewhere"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, CodeForbidden, ret.Code)
+	code, ret = errorOf(http.MethodGet, urlOf(filepath.Join(root, "missing.txt"), "chunk/manifest"), "")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, CodeNotFound, ret.Code)
+	code, ret = errorOf(http.MethodGet, "/upload/unknown", "")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, CodeUnavailable, ret.Code)
+	code, ret = errorOf(http.MethodDelete, "/trash/unknown", "")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, CodeNotFound, ret.Code)
+}
@@ -0,0 +1,190 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/config"
+	"github.com/newm4n/Adverter/server/web/model"
+	"net/http"
+	"path/filepath"
+	"strconv"
+)
+
+type FileOpRequest struct {
+	Name      string
+	Directory string
+	Overwrite bool
+}
+
+// Router.Handle("/path/{b64path}/mkdir", CreateDirectory)
+func CreateDirectory(w http.ResponseWriter, r *http.Request) {
+	path, opReq, ok := fileOpOf(w, r)
+	if !ok {
+		return
+	}
+	tDir, err := model.NewTheDirectory(path)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	newDir, err := model.MakeDirectory(tDir, opReq.Name)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	writeDirItem(w, r, http.StatusCreated, newDir.Name, newDir.DirPath, "directories")
+}
+
+// Router.Handle("/path/{b64path}/rename", RenameItem)
+func RenameItem(w http.ResponseWriter, r *http.Request) {
+	path, opReq, ok := fileOpOf(w, r)
+	if !ok {
+		return
+	}
+	if model.Library.IsRoot(path) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "access denied", fmt.Sprintf("%s is a media root", path))
+		return
+	}
+	newPath, err := model.RenamePath(path, opReq.Name, opReq.Overwrite)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	writeMovedItem(w, r, newPath)
+}
+
+// Router.Handle("/path/{b64path}/move", MoveItem)
+func MoveItem(w http.ResponseWriter, r *http.Request) {
+	path, opReq, ok := fileOpOf(w, r)
+	if !ok {
+		return
+	}
+	if model.Library.IsRoot(path) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "access denied", fmt.Sprintf("%s is a media root", path))
+		return
+	}
+	if !writable(opReq.Directory) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "access denied", fmt.Sprintf("%s is outside of media roots", opReq.Directory))
+		return
+	}
+	newPath, err := model.MovePath(path, opReq.Directory, opReq.Name, opReq.Overwrite)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	writeMovedItem(w, r, newPath)
+}
+
+// Router.Handle("/path/{b64path}/copy", CopyItem)
+func CopyItem(w http.ResponseWriter, r *http.Request) {
+	path, opReq, ok := fileOpOf(w, r)
+	if !ok {
+		return
+	}
+	if !writable(opReq.Directory) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "access denied", fmt.Sprintf("%s is outside of media roots", opReq.Directory))
+		return
+	}
+	newPath, err := model.CopyPath(path, opReq.Directory, opReq.Name, opReq.Overwrite)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	writeDirItem(w, r, http.StatusCreated, filepath.Base(newPath), newPath, "chunk/info")
+}
+
+// Router.Handle("/path/{b64path}", DeleteItem)
+// The item is moved into the trash of its root unless the trash query parameter is false.
+func DeleteItem(w http.ResponseWriter, r *http.Request) {
+	path, ok := writablePathOf(w, r)
+	if !ok {
+		return
+	}
+	if model.Library.IsRoot(path) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "access denied", fmt.Sprintf("%s is a media root", path))
+		return
+	}
+	toTrash := config.GetBoolean("media.delete.trash")
+	if trashParam := r.URL.Query().Get("trash"); len(trashParam) > 0 {
+		b, err := strconv.ParseBool(trashParam)
+		if err != nil {
+			writeInvalidParam(w, r, err)
+			return
+		}
+		toTrash = b
+	}
+	if !toTrash {
+		if err := model.DeletePath(path); err != nil {
+			writeModelError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	item, err := model.TrashPath(model.Library.RootOf(path), path)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	writeTrashItem(w, r, http.StatusOK, item)
+}
+
+// writablePathOf decodes the b64path of the request and makes sure it lies within a media root
+func writablePathOf(w http.ResponseWriter, r *http.Request) (string, bool) {
+	pathInfo, err := model.NewPathInfoFromBase64(mux.Vars(r)["b64path"])
+	if err != nil {
+		writeInvalidParam(w, r, err)
+		return "", false
+	}
+	if !writable(pathInfo.Path) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "access denied", fmt.Sprintf("%s is outside of media roots", pathInfo.Path))
+		return "", false
+	}
+	return pathInfo.Path, true
+}
+
+func fileOpOf(w http.ResponseWriter, r *http.Request) (string, *FileOpRequest, bool) {
+	path, ok := writablePathOf(w, r)
+	if !ok {
+		return "", nil, false
+	}
+	opReq := &FileOpRequest{}
+	if err := json.NewDecoder(r.Body).Decode(opReq); err != nil {
+		writeInvalidParam(w, r, err)
+		return "", nil, false
+	}
+	return path, opReq, true
+}
+
+func writeMovedItem(w http.ResponseWriter, r *http.Request, path string) {
+	inf, err := model.StatPath(path)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	if inf.IsDir() {
+		writeDirItem(w, r, http.StatusOK, inf.Name(), path, "directories")
+	} else {
+		writeDirItem(w, r, http.StatusOK, inf.Name(), path, "chunk/info")
+	}
+}
+
+func writeDirItem(w http.ResponseWriter, r *http.Request, status int, name, path, endpoint string) {
+	pi := &model.PathInfo{
+		Path: path,
+	}
+	d := &DirItemRespond{
+		Name: name,
+		Path: path,
+		URL:  fmt.Sprintf("/path/%s/%s", pi.ToPathInfoString(), endpoint),
+	}
+	retBytes, err := json.Marshal(d)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(retBytes)
+}
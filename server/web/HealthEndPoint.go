@@ -0,0 +1,181 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hyperjumptech/jiffy"
+	"github.com/newm4n/Adverter/server/config"
+	"github.com/newm4n/Adverter/server/web/model"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// Version of this build, set with -ldflags "-X github.com/newm4n/Adverter/server/web.Version=1.2.3"
+	Version = "dev"
+	// Commit this build was made from, read from the Go build info when not set with -ldflags
+	Commit = ""
+
+	startTime    = time.Now()
+	shuttingDown atomic.Bool
+)
+
+type HealthRespond struct {
+	Status    string
+	Version   string
+	Commit    string
+	GoVersion string
+	StartTime time.Time
+	Uptime    string
+}
+
+type CheckRespond struct {
+	Name    string
+	OK      bool
+	Message string
+}
+
+type ReadinessRespond struct {
+	Ready  bool
+	Checks []*CheckRespond
+}
+
+// Router.Handle("/healthz", GetHealth)
+// Liveness: answers as long as the server serves requests, checking nothing else.
+func GetHealth(w http.ResponseWriter, r *http.Request) {
+	ret := &HealthRespond{
+		Status:    "ok",
+		Version:   Version,
+		Commit:    commitOf(),
+		GoVersion: runtime.Version(),
+		StartTime: startTime,
+		Uptime:    time.Since(startTime).Round(time.Second).String(),
+	}
+	writeHealth(w, r, http.StatusOK, ret)
+}
+
+// Router.Handle("/readyz", GetReadiness)
+// Readiness: the configuration is valid, every media root is accessible, the chunk index is loaded
+// and the server is not shutting down. Answers 503 otherwise. Probes are anonymous, so why a check
+// failed is only logged.
+func GetReadiness(w http.ResponseWriter, r *http.Request) {
+	ret := &ReadinessRespond{
+		Ready: true,
+		Checks: []*CheckRespond{
+			check(r, "shutdown", checkNotShuttingDown()),
+			check(r, "config", ValidateConfig()),
+			check(r, "roots", checkRoots()),
+			check(r, "manifests", checkChunkIndex()),
+		},
+	}
+	status := http.StatusOK
+	for _, c := range ret.Checks {
+		if !c.OK {
+			ret.Ready = false
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeHealth(w, r, status, ret)
+}
+
+func writeHealth(w http.ResponseWriter, r *http.Request, status int, ret interface{}) {
+	retBytes, err := json.Marshal(ret)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(retBytes)
+}
+
+func check(r *http.Request, name string, err error) *CheckRespond {
+	if err != nil {
+		model.Logger(r.Context()).Warnf("readiness check %s failed. got %s", name, err.Error())
+		return &CheckRespond{Name: name, OK: false, Message: "check failed"}
+	}
+	return &CheckRespond{Name: name, OK: true}
+}
+
+func checkNotShuttingDown() error {
+	if shuttingDown.Load() {
+		return fmt.Errorf("shutting down")
+	}
+	return nil
+}
+
+func checkRoots() error {
+	if model.Library == nil {
+		return fmt.Errorf("media index is not available")
+	}
+	for _, root := range model.Library.Roots() {
+		inf, err := model.StatPath(root)
+		if err != nil {
+			return fmt.Errorf("can not access %s. got %s", root, err.Error())
+		}
+		if !inf.IsDir() {
+			return fmt.Errorf("%s is not a directory", root)
+		}
+	}
+	return nil
+}
+
+func checkChunkIndex() error {
+	if config.GetBoolean("media.chunks.index") && (model.Chunks == nil || !model.Chunks.Indexed()) {
+		return fmt.Errorf("chunk index is still loading")
+	}
+	return nil
+}
+
+// ValidateConfig checks every configuration value the server parses, so a bad value is reported
+// rather than panicking when first used
+func ValidateConfig() error {
+	for _, key := range []string{"server.timeout.write", "server.timeout.read", "server.timeout.idle",
+		"server.timeout.graceshut", "server.timeout.unready", "media.index.rescan", "media.trash.retention",
+		"media.trash.purge.interval", "upload.session.expiry"} {
+		if _, err := jiffy.DurationOf(config.Get(key)); err != nil {
+			return fmt.Errorf("invalid %s. got %s", key, err.Error())
+		}
+	}
+	if _, err := model.ParseChunking(config.Get("media.chunks.chunking")); err != nil {
+		return fmt.Errorf("invalid media.chunks.chunking. got %s", err.Error())
+	}
+	if _, err := loadRateLimiter(); err != nil {
+		return fmt.Errorf("invalid server.ratelimit. got %s", err.Error())
+	}
+	if _, err := loadThrottle(); err != nil {
+		return fmt.Errorf("invalid server.throttle. got %s", err.Error())
+	}
+	if _, ok := tokenAlgorithms[config.Get("token.crypt.method")]; !ok {
+		return fmt.Errorf("unsupported token.crypt.method %s", config.Get("token.crypt.method"))
+	}
+	if len(config.Get("media.roots")) > 0 && len(config.Get("media.mounts")) > 0 {
+		// named mounts replace the local disk paths, which would then be indexed but never served
+		return fmt.Errorf("media.roots and media.mounts can not be both set. mount the roots instead")
+	}
+	if config.GetBoolean("server.auth.enable") {
+		if _, err := tokenKey(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commitOf returns Commit, or the VCS revision recorded by the Go toolchain
+func commitOf() string {
+	if len(Commit) > 0 {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,80 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/config"
+	"github.com/newm4n/Adverter/server/web/model"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthAndReadiness(t *testing.T) {
+	useTokenKey(t)
+	Router = mux.NewRouter()
+	Router.HandleFunc("/healthz", GetHealth).Methods(http.MethodGet)
+	Router.HandleFunc("/readyz", GetReadiness).Methods(http.MethodGet)
+
+	request, _ := http.NewRequest(http.MethodGet, "/healthz", nil)
+	response := httptest.NewRecorder()
+	Router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+	health := &HealthRespond{}
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), health))
+	assert.Equal(t, "ok", health.Status)
+	assert.Equal(t, Version, health.Version)
+	assert.NotEmpty(t, health.GoVersion)
+
+	readiness := func() (int, *ReadinessRespond) {
+		request, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+		response := httptest.NewRecorder()
+		Router.ServeHTTP(response, request)
+		ret := &ReadinessRespond{}
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), ret))
+		return response.Code, ret
+	}
+
+	// the default token key signs nothing
+	config.Set("token.crypt.key", config.DefaultTokenKey)
+	code, ready := readiness()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, ready.Checks[1].OK)
+	assert.NotContains(t, ready.Checks[1].Message, "token")
+	useTokenKey(t)
+
+	// no media index yet
+	code, ready = readiness()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, ready.Ready)
+
+	model.Library = model.NewMediaIndex(t.TempDir())
+	defer func() { model.Library = nil }()
+	model.Chunks = model.NewChunkIndex(model.ChunkingCDC)
+	defer func() { model.Chunks = nil }()
+	code, ready = readiness()
+	// chunk index still loading
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	model.Chunks.IndexLibrary(model.Library)
+	code, ready = readiness()
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, ready.Ready)
+	assert.Len(t, ready.Checks, 4)
+
+	missing := t.TempDir() + "/missing"
+	model.Library = model.NewMediaIndex(missing)
+	code, ready = readiness()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "roots", ready.Checks[2].Name)
+	assert.NotContains(t, ready.Checks[2].Message, missing)
+
+	model.Library = model.NewMediaIndex(t.TempDir())
+	shuttingDown.Store(true)
+	defer shuttingDown.Store(false)
+	code, ready = readiness()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "shutdown", ready.Checks[0].Name)
+	assert.False(t, ready.Checks[0].OK)
+}
@@ -0,0 +1,141 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/web/model"
+	"net/http"
+)
+
+type ChunkRespond struct {
+	Index  int
+	Offset int64
+	Size   int
+	Hash   string
+	Weak   uint32
+}
+
+type ChunkManifestRespond struct {
+	Name       string
+	Path       string
+	Chunking   string
+	Size       int64
+	ChunkSize  int
+	ChunkCount int
+	FileHash   string
+	Chunks     []*ChunkRespond
+}
+
+type ChunkDeltaRequest struct {
+	Hashes []string
+}
+
+type ChunkDeltaRespond struct {
+	Chunking   string
+	ChunkCount int
+	ChunkSize  int
+	Changed    []int
+}
+
+// Router.Handle("/path/{b64path}/chunk/manifest", GetChunkManifest)
+// The chunking query parameter selects fixed (default) or cdc chunks.
+func GetChunkManifest(w http.ResponseWriter, r *http.Request) {
+	varMap := mux.Vars(r)
+	b64Path := varMap["b64path"]
+	pathInfo, err := model.NewPathInfoFromBase64(b64Path)
+	if err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	chunking, err := model.ParseChunking(r.URL.Query().Get("chunking"))
+	if err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	tFile, err := model.NewTheFile(pathInfo.Path)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	tFile.WithContext(r.Context())
+	manifest, err := model.ManifestOf(tFile, chunking)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+
+	ret := &ChunkManifestRespond{
+		Name:       tFile.Name,
+		Path:       tFile.FilePath,
+		Chunking:   string(manifest.Chunking),
+		Size:       manifest.Size,
+		ChunkSize:  manifest.ChunkSize,
+		ChunkCount: len(manifest.Chunks),
+		FileHash:   manifest.FileHash,
+		Chunks:     make([]*ChunkRespond, 0, len(manifest.Chunks)),
+	}
+	for _, chunk := range manifest.Chunks {
+		ret.Chunks = append(ret.Chunks, &ChunkRespond{
+			Index:  chunk.Index,
+			Offset: chunk.Offset,
+			Size:   chunk.Size,
+			Hash:   chunk.Hash,
+			Weak:   chunk.Weak,
+		})
+	}
+	retBytes, err := json.Marshal(ret)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(retBytes)
+}
+
+// Router.Handle("/path/{b64path}/chunk/delta", GetChunkDelta)
+func GetChunkDelta(w http.ResponseWriter, r *http.Request) {
+	varMap := mux.Vars(r)
+	b64Path := varMap["b64path"]
+	pathInfo, err := model.NewPathInfoFromBase64(b64Path)
+	if err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	req := &ChunkDeltaRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	chunking, err := model.ParseChunking(r.URL.Query().Get("chunking"))
+	if err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	tFile, err := model.NewTheFile(pathInfo.Path)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	tFile.WithContext(r.Context())
+	manifest, err := model.ManifestOf(tFile, chunking)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+
+	ret := &ChunkDeltaRespond{
+		Chunking:   string(manifest.Chunking),
+		ChunkCount: len(manifest.Chunks),
+		ChunkSize:  manifest.ChunkSize,
+		Changed:    manifest.ChangedChunks(req.Hashes),
+	}
+	retBytes, err := json.Marshal(ret)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(retBytes)
+}
@@ -0,0 +1,122 @@
+package web
+
+import (
+	"bytes"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/metrics"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	httpRequests = metrics.NewCounter("adverter_http_requests_total",
+		"Requests served, by route template, method and status code", "route", "method", "code")
+	httpDuration = metrics.NewHistogram("adverter_http_request_duration_seconds",
+		"Time spent serving requests, by route template and method", metrics.DefBuckets, "route", "method")
+	bytesServed = metrics.NewCounter("adverter_http_response_bytes_total",
+		"Bytes of response bodies sent, after compression, by route template", "route")
+	activeConnections = metrics.NewGauge("adverter_http_active_connections",
+		"Client connections currently open")
+)
+
+// Router.Handle("/metrics", GetMetrics)
+// Serves the server and transfer statistics in the Prometheus text exposition format.
+func GetMetrics(w http.ResponseWriter, r *http.Request) {
+	buf := &bytes.Buffer{}
+	if err := metrics.WriteText(buf); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// Instrumented is a middleware counting the requests, their duration and the bytes sent, by route template
+func Instrumented(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		mw := &meteredWriter{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		defer func() {
+			httpDuration.Observe(time.Since(start).Seconds(), route, r.Method)
+			httpRequests.Inc(route, r.Method, strconv.Itoa(mw.status))
+			bytesServed.Add(float64(mw.written), route)
+		}()
+		next.ServeHTTP(mw, r)
+	})
+}
+
+// meteredWriter records the status and the size of a response
+type meteredWriter struct {
+	http.ResponseWriter
+	status      int
+	written     int64
+	wroteHeader bool
+}
+
+func (mw *meteredWriter) WriteHeader(status int) {
+	if !mw.wroteHeader {
+		mw.wroteHeader = true
+		mw.status = status
+	}
+	mw.ResponseWriter.WriteHeader(status)
+}
+
+func (mw *meteredWriter) Write(p []byte) (int, error) {
+	mw.wroteHeader = true
+	n, err := mw.ResponseWriter.Write(p)
+	mw.written += int64(n)
+	return n, err
+}
+
+func (mw *meteredWriter) Flush() {
+	if flusher, ok := mw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (mw *meteredWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
+
+// touchRouteMetrics walks the routes of the router so every route template is listed in the metrics,
+// even before its first request
+func touchRouteMetrics() {
+	err := Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			httpDuration.Touch(template, method)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// trackConnections keeps adverter_http_active_connections current, it is meant as http.Server ConnState
+func trackConnections(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		activeConnections.Add(1)
+	case http.StateClosed, http.StateHijacked:
+		activeConnections.Add(-1)
+	}
+}
@@ -0,0 +1,38 @@
+package web
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInstrumented(t *testing.T) {
+	Router = mux.NewRouter()
+	Router.Use(Instrumented)
+	Router.HandleFunc("/metrics", GetMetrics).Methods(http.MethodGet)
+	Router.HandleFunc("/path/{b64path}/files", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}).Methods(http.MethodGet)
+	Router.HandleFunc("/path/{b64path}/directories", ListDirectories).Methods(http.MethodGet)
+	touchRouteMetrics()
+
+	before := httpRequests.Value("/path/{b64path}/files", http.MethodGet, "418")
+	bytesBefore := bytesServed.Value("/path/{b64path}/files")
+	request, _ := http.NewRequest(http.MethodGet, "/path/a.b/files", nil)
+	Router.ServeHTTP(httptest.NewRecorder(), request)
+	assert.Equal(t, before+1, httpRequests.Value("/path/{b64path}/files", http.MethodGet, "418"))
+	assert.Equal(t, bytesBefore+15, bytesServed.Value("/path/{b64path}/files"))
+
+	request, _ = http.NewRequest(http.MethodGet, "/metrics", nil)
+	response := httptest.NewRecorder()
+	Router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+	body := response.Body.String()
+	assert.Contains(t, body, `adverter_http_requests_total{route="/path/{b64path}/files",method="GET",code="418"}`)
+	// listed from Router.Walk before any request
+	assert.Contains(t, body, `adverter_http_request_duration_seconds_count{route="/path/{b64path}/directories",method="GET"} 0`)
+	assert.Contains(t, body, "# TYPE adverter_hash_duration_seconds histogram")
+}
@@ -0,0 +1,144 @@
+package web
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/config"
+	"github.com/newm4n/Adverter/server/web/model"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RateLimit is a number of requests per second, with Burst requests allowed at once
+type RateLimit struct {
+	Rate  float64
+	Burst float64
+}
+
+// RateLimiter limits the requests of every client, or IP when the client is anonymous, on every route
+type RateLimiter struct {
+	limit   RateLimit
+	routes  map[string]RateLimit
+	buckets *bucketSet
+}
+
+var (
+	rateLimiter     *RateLimiter
+	rateLimiterOnce sync.Once
+)
+
+// NewRateLimiter creates a limiter applying limit on every route but those of routes, keyed by route template
+func NewRateLimiter(limit RateLimit, routes map[string]RateLimit) *RateLimiter {
+	return &RateLimiter{
+		limit:   limit,
+		routes:  routes,
+		buckets: newBucketSet(),
+	}
+}
+
+// Allow tells whether the client may send one more request on route, otherwise how many seconds to wait
+func (rl *RateLimiter) Allow(client, route string) (bool, int) {
+	limit, ok := rl.routes[route]
+	if !ok {
+		limit = rl.limit
+	}
+	if limit.Rate <= 0 {
+		return true, 0
+	}
+	allowed, wait := rl.buckets.getOrCreate(client+" "+route, limit.Rate, limit.Burst).allow(1)
+	return allowed, int(math.Ceil(wait.Seconds()))
+}
+
+// rateLimiterOf builds the rate limiter from configuration, once
+func rateLimiterOf() *RateLimiter {
+	rateLimiterOnce.Do(func() {
+		var err error
+		if rateLimiter, err = loadRateLimiter(); err != nil {
+			panic(err)
+		}
+	})
+	return rateLimiter
+}
+
+// loadRateLimiter reads the server.ratelimit.* configuration
+func loadRateLimiter() (*RateLimiter, error) {
+	limit, err := ParseRateLimit(config.Get("server.ratelimit.default"))
+	if err != nil {
+		return nil, err
+	}
+	routes := make(map[string]RateLimit)
+	for _, item := range strings.Split(config.Get("server.ratelimit.routes"), ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		// route templates hold no '=', the limit follows the last one
+		idx := strings.LastIndex(item, "=")
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid server.ratelimit.routes entry %s. expecting route=rate/burst", item)
+		}
+		if routes[item[:idx]], err = ParseRateLimit(item[idx+1:]); err != nil {
+			return nil, err
+		}
+	}
+	return NewRateLimiter(limit, routes), nil
+}
+
+// ParseRateLimit reads "rate/burst", eg. "10/50" for 10 requests per second and bursts of 50.
+// The burst defaults to the rate, a rate of 0 means unlimited.
+func ParseRateLimit(limit string) (RateLimit, error) {
+	rate, burst, hasBurst := strings.Cut(strings.TrimSpace(limit), "/")
+	ret := RateLimit{}
+	var err error
+	if ret.Rate, err = strconv.ParseFloat(strings.TrimSpace(rate), 64); err != nil || ret.Rate < 0 {
+		return ret, fmt.Errorf("invalid rate limit %s. expecting rate/burst", limit)
+	}
+	ret.Burst = math.Max(ret.Rate, 1)
+	if hasBurst {
+		if ret.Burst, err = strconv.ParseFloat(strings.TrimSpace(burst), 64); err != nil || ret.Burst < 1 {
+			return ret, fmt.Errorf("invalid rate limit %s. expecting rate/burst", limit)
+		}
+	}
+	return ret, nil
+}
+
+// unlimitedRoutes are never rate limited, so probes and scrapers keep working while clients are limited
+var unlimitedRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// RateLimited is a middleware answering 429 Too Many Requests, with Retry-After, to the clients sending more
+// requests on a route than server.ratelimit.* allow. Clients are told apart by clientKey.
+func RateLimited(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !config.GetBoolean("server.ratelimit.enable") || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// a bucket per raw path would grow without bound, requests out of any route share one
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		if unlimitedRoutes[route] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := clientKey(r)
+		if allowed, retryAfter := rateLimiterOf().Allow(client, route); !allowed {
+			model.Logger(r.Context()).Warnf("rate limit hit by %s on %s", client, route)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeError(w, r, http.StatusTooManyRequests, CodeTooManyRequests, "too many requests",
+				fmt.Sprintf("retry after %d seconds", retryAfter))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,81 @@
+package web
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimited(t *testing.T) {
+	useTokenKey(t)
+	rateLimiterOnce.Do(func() {})
+	rateLimiter = NewRateLimiter(RateLimit{Rate: 100, Burst: 100}, map[string]RateLimit{
+		"/path/{b64path}/chunk/info": {Rate: 1, Burst: 2},
+	})
+	defer func() { rateLimiter = nil; rateLimiterOnce = sync.Once{} }()
+
+	Router = mux.NewRouter()
+	Router.Use(RateLimited)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	Router.HandleFunc("/path/{b64path}/chunk/info", ok).Methods(http.MethodGet)
+	Router.HandleFunc("/path/{b64path}/files", ok).Methods(http.MethodGet)
+	Router.HandleFunc("/healthz", ok).Methods(http.MethodGet)
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodGet, path, nil)
+		request.RemoteAddr = "10.0.0.1:5000"
+		if len(token) > 0 {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		response := httptest.NewRecorder()
+		Router.ServeHTTP(response, request)
+		return response
+	}
+	assert.Equal(t, http.StatusOK, get("/path/a.b/chunk/info", "").Code)
+	assert.Equal(t, http.StatusOK, get("/path/c.d/chunk/info", "").Code)
+	response := get("/path/a.b/chunk/info", "")
+	assert.Equal(t, http.StatusTooManyRequests, response.Code)
+	assert.Equal(t, "1", response.Header().Get("Retry-After"))
+
+	// other routes and other clients have their own buckets
+	assert.Equal(t, http.StatusOK, get("/path/a.b/files", "").Code)
+	token, err := SignToken("player-7", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, get("/path/a.b/chunk/info", token).Code)
+
+	// probes are not limited
+	for i := 0; i < 300; i++ {
+		assert.Equal(t, http.StatusOK, get("/healthz", "").Code)
+	}
+
+	// requests outside of any route share a single bucket, whatever their path
+	outside := RateLimited(http.HandlerFunc(ok))
+	codes := make(map[int]int)
+	for i := 0; i < 150; i++ {
+		request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/nowhere/%d", i), nil)
+		request.RemoteAddr = "10.0.0.2:5000"
+		response := httptest.NewRecorder()
+		outside.ServeHTTP(response, request)
+		codes[response.Code]++
+	}
+	assert.Greater(t, codes[http.StatusTooManyRequests], 0)
+
+	// a client naming itself is still told apart by its IP only
+	request, _ := http.NewRequest(http.MethodGet, "/path/a.b/chunk/info", nil)
+	request.RemoteAddr = "10.0.0.1:5000"
+	request.Header.Set("X-Client-ID", "player-8")
+	response = httptest.NewRecorder()
+	Router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusTooManyRequests, response.Code)
+
+	limit, err := ParseRateLimit("10/50")
+	assert.NoError(t, err)
+	assert.Equal(t, RateLimit{Rate: 10, Burst: 50}, limit)
+	_, err = ParseRateLimit("fast")
+	assert.Error(t, err)
+}
@@ -0,0 +1,37 @@
+package web
+
+import (
+	"github.com/newm4n/Adverter/server/metrics"
+	"github.com/newm4n/Adverter/server/web/model"
+	"net/http"
+	"runtime/debug"
+)
+
+var handlerPanics = metrics.NewCounter("adverter_http_panics_total",
+	"Handler panics recovered, answered with 500")
+
+// Recovered is a middleware turning a panic of a handler into a logged 500, rather than a dropped connection.
+// When the response has already begun the connection is dropped anyway, only the log is added.
+func Recovered(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mw := &meteredWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				// the handler meant to abort the response, net/http knows not to log it
+				panic(recovered)
+			}
+			handlerPanics.Inc()
+			model.Logger(r.Context()).WithField("stack", string(debug.Stack())).
+				Errorf("panic serving %s %s. got %v", r.Method, r.URL.Path, recovered)
+			if mw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			writeError(mw, r, http.StatusInternalServerError, CodeInternal, "internal error", "")
+		}()
+		next.ServeHTTP(mw, r)
+	})
+}
@@ -0,0 +1,58 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/web/model"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecovered(t *testing.T) {
+	Router = mux.NewRouter()
+	Router.Use(Instrumented)
+	Router.Use(Recovered)
+	Router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		var chunks []int
+		w.Write([]byte(fmt.Sprint(chunks[3])))
+	}).Methods(http.MethodGet)
+	Router.HandleFunc("/abort", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}).Methods(http.MethodGet)
+	touchRouteMetrics()
+
+	panicsBefore := handlerPanics.Value()
+	requestsBefore := httpRequests.Value("/panic", http.MethodGet, "500")
+	request, _ := http.NewRequest(http.MethodGet, "/panic", nil)
+	response := httptest.NewRecorder()
+	assert.NotPanics(t, func() { Router.ServeHTTP(response, request) })
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	ret := &ErrorRespond{}
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), ret))
+	assert.Equal(t, CodeInternal, ret.Code)
+	assert.Equal(t, panicsBefore+1, handlerPanics.Value())
+	assert.Equal(t, requestsBefore+1, httpRequests.Value("/panic", http.MethodGet, "500"))
+
+	request, _ = http.NewRequest(http.MethodGet, "/abort", nil)
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() { Router.ServeHTTP(httptest.NewRecorder(), request) })
+}
+
+func TestGetChunkDataOutOfRange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "intro.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("hello"), 0644))
+
+	Router = mux.NewRouter()
+	Router.HandleFunc("/path/{b64path}/chunk/{chunkno}", GetChunkData).Methods(http.MethodGet)
+	pi := model.PathInfo{Path: path}
+	for _, chunkNo := range []string{"-1", "1", "999"} {
+		request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/path/%s/chunk/%s", pi.ToPathInfoString(), chunkNo), nil)
+		response := httptest.NewRecorder()
+		Router.ServeHTTP(response, request)
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, response.Code, chunkNo)
+	}
+}
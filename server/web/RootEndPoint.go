@@ -0,0 +1,36 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/newm4n/Adverter/server/web/model"
+	"net/http"
+	"path/filepath"
+)
+
+// Router.Handle("/roots", ListRoots)
+func ListRoots(w http.ResponseWriter, r *http.Request) {
+	if model.Library == nil {
+		writeError(w, r, http.StatusServiceUnavailable, CodeUnavailable, "media index is not available", "")
+		return
+	}
+	ret := make([]*DirItemRespond, 0)
+	for _, root := range model.Library.Roots() {
+		pi := &model.PathInfo{
+			Path: root,
+		}
+		ret = append(ret, &DirItemRespond{
+			Name: filepath.Base(root),
+			Path: root,
+			URL:  fmt.Sprintf("/path/%s/directories", pi.ToPathInfoString()),
+		})
+	}
+	retBytes, err := json.Marshal(ret)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(retBytes)
+}
@@ -0,0 +1,33 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/storage"
+	"github.com/newm4n/Adverter/server/web/model"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListRoots(t *testing.T) {
+	assert.NoError(t, model.Mount("/campaigns", storage.NewMemory()))
+	defer model.Unmount("/campaigns")
+	model.Library = model.NewMediaIndex(model.MountPoints()...)
+	defer func() { model.Library = nil }()
+
+	Router = mux.NewRouter()
+	Router.HandleFunc("/roots", ListRoots).Methods(http.MethodGet)
+
+	request, _ := http.NewRequest(http.MethodGet, "/roots", nil)
+	response := httptest.NewRecorder()
+	Router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	roots := make([]*DirItemRespond, 0)
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &roots))
+	assert.Len(t, roots, 1)
+	assert.Equal(t, "campaigns", roots[0].Name)
+	assert.Equal(t, "/campaigns", roots[0].Path)
+}
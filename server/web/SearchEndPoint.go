@@ -0,0 +1,159 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/newm4n/Adverter/server/config"
+	"github.com/newm4n/Adverter/server/web/model"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SearchItemRespond struct {
+	Name    string
+	Path    string
+	Root    string
+	Ext     string
+	Size    int64
+	ModTime time.Time
+	Tags    []string
+	URL     string
+}
+
+type SearchRespond struct {
+	Total  int
+	Offset int
+	Limit  int
+	Items  []*SearchItemRespond
+}
+
+// Router.Handle("/search", Search)
+func Search(w http.ResponseWriter, r *http.Request) {
+	if model.Library == nil {
+		writeError(w, r, http.StatusServiceUnavailable, CodeUnavailable, "media index is not available", "")
+		return
+	}
+	query, err := NewSearchQuery(r)
+	if err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	entries, total := model.Library.Search(query)
+
+	ret := &SearchRespond{
+		Total:  total,
+		Offset: query.Offset,
+		Limit:  query.Limit,
+		Items:  make([]*SearchItemRespond, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		pi := &model.PathInfo{
+			Path: entry.Path,
+		}
+		ret.Items = append(ret.Items, &SearchItemRespond{
+			Name:    entry.Name,
+			Path:    entry.Path,
+			Root:    entry.Root,
+			Ext:     entry.Ext,
+			Size:    entry.Size,
+			ModTime: entry.ModTime,
+			Tags:    entry.Tags,
+			URL:     fmt.Sprintf("/path/%s/chunk/info", pi.ToPathInfoString()),
+		})
+	}
+	retBytes, err := json.Marshal(ret)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(retBytes)
+}
+
+// NewSearchQuery reads the search criteria from the request query string.
+// Supported parameters are q, path, ext, tag, minSize, maxSize, from, to, offset and limit.
+// ext and tag can be repeated or comma separated, from and to are RFC3339 or yyyy-mm-dd dates.
+func NewSearchQuery(r *http.Request) (*model.SearchQuery, error) {
+	values := r.URL.Query()
+	query := &model.SearchQuery{
+		Text:     values.Get("q"),
+		PathPart: values.Get("path"),
+		Ext:      splitValues(values["ext"]),
+		Tags:     splitValues(values["tag"]),
+		Limit:    config.GetInt("media.search.limit"),
+	}
+	var err error
+	if query.MinSize, err = int64Param(values.Get("minSize")); err != nil {
+		return nil, err
+	}
+	if query.MaxSize, err = int64Param(values.Get("maxSize")); err != nil {
+		return nil, err
+	}
+	if query.From, err = timeParam(values.Get("from"), false); err != nil {
+		return nil, err
+	}
+	if query.To, err = timeParam(values.Get("to"), true); err != nil {
+		return nil, err
+	}
+	offset, err := int64Param(values.Get("offset"))
+	if err != nil {
+		return nil, err
+	}
+	query.Offset = int(offset)
+	limit, err := int64Param(values.Get("limit"))
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && (query.Limit <= 0 || int(limit) < query.Limit) {
+		query.Limit = int(limit)
+	}
+	return query, nil
+}
+
+func splitValues(values []string) []string {
+	ret := make([]string, 0)
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); len(s) > 0 {
+				ret = append(ret, s)
+			}
+		}
+	}
+	return ret
+}
+
+func int64Param(value string) (int64, error) {
+	if len(value) == 0 {
+		return 0, nil
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 {
+		return 0, fmt.Errorf("%d is negative", i)
+	}
+	return i, nil
+}
+
+// timeParam parse a RFC3339 time or a plain date. When endOfDay is true, a plain date
+// is taken as the last instant of that day so the range is inclusive.
+func timeParam(value string, endOfDay bool) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is not a RFC3339 time nor yyyy-mm-dd date", value)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
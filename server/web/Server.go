@@ -6,30 +6,225 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/hyperjumptech/jiffy"
 	"github.com/newm4n/Adverter/server/config"
+	"github.com/newm4n/Adverter/server/storage"
+	"github.com/newm4n/Adverter/server/web/model"
 	log "github.com/sirupsen/logrus"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 )
 
 var (
 	// Router instance of gorilla mux.Router
 	Router *mux.Router
+
+	trashPurger *model.TrashPurger
 )
 
 // InitializeRouter initializes Gorilla Mux and all handler, including Database and Mailer connector
 func InitializeRouter() {
 	log.Info("Initializing server")
 	Router = mux.NewRouter()
+	Router.Use(Logged)
+	Router.Use(Instrumented)
+	Router.Use(Recovered)
+	Router.Use(RateLimited)
 
-	Router.HandleFunc("/path/{b64path}/files", ListFiles).Methods(http.MethodGet)
-	Router.HandleFunc("/path/{b64path}/directories", ListDirectories).Methods(http.MethodGet)
+	Router.HandleFunc("/path/{b64path}/files", Compressed(ListFiles)).Methods(http.MethodGet)
+	Router.HandleFunc("/path/{b64path}/directories", Compressed(ListDirectories)).Methods(http.MethodGet)
 	Router.HandleFunc("/path/{b64path}/chunk/info", GetChunkInfo).Methods(http.MethodGet)
-	Router.HandleFunc("/path/{b64path}/chunk/{chunkno}", GetChunkData).Methods(http.MethodGet)
+	Router.HandleFunc("/path/{b64path}/chunk/manifest", Compressed(GetChunkManifest)).Methods(http.MethodGet)
+	Router.HandleFunc("/path/{b64path}/chunk/delta", GetChunkDelta).Methods(http.MethodPost)
+	Router.HandleFunc("/path/{b64path}/chunk/batch", Throttled(Compressed(GetChunkBatch))).Methods(http.MethodGet)
+	Router.HandleFunc("/path/{b64path}/chunk/{chunkno}", Throttled(Compressed(GetChunkData))).Methods(http.MethodGet)
+	Router.HandleFunc("/path/{b64path}/bundle", Throttled(GetBundle)).Methods(http.MethodGet)
+	Router.HandleFunc("/chunks/{hash}", Throttled(Compressed(GetChunkByHash))).Methods(http.MethodGet)
+	Router.HandleFunc("/metrics", GetMetrics).Methods(http.MethodGet)
+	Router.HandleFunc("/healthz", GetHealth).Methods(http.MethodGet)
+	Router.HandleFunc("/readyz", GetReadiness).Methods(http.MethodGet)
+	Router.HandleFunc("/search", Compressed(Search)).Methods(http.MethodGet)
+	Router.HandleFunc("/roots", Compressed(ListRoots)).Methods(http.MethodGet)
+	Router.HandleFunc("/path/{b64path}/upload", Authenticated(InitiateUpload)).Methods(http.MethodPost)
+	Router.HandleFunc("/upload/{uploadid}", Authenticated(GetUpload)).Methods(http.MethodGet)
+	Router.HandleFunc("/upload/{uploadid}", Authenticated(AbortUpload)).Methods(http.MethodDelete)
+	Router.HandleFunc("/upload/{uploadid}/chunk/{chunkno}", Authenticated(PutUploadChunk)).Methods(http.MethodPut)
+	Router.HandleFunc("/upload/{uploadid}/finalize", Authenticated(FinalizeUpload)).Methods(http.MethodPost)
+	Router.HandleFunc("/tus", TusOptions).Methods(http.MethodOptions)
+	Router.HandleFunc("/tus", Authenticated(TusCreate)).Methods(http.MethodPost)
+	Router.HandleFunc("/path/{b64path}/tus", TusOptions).Methods(http.MethodOptions)
+	Router.HandleFunc("/path/{b64path}/tus", Authenticated(TusCreate)).Methods(http.MethodPost)
+	Router.HandleFunc("/tus/{uploadid}", TusOptions).Methods(http.MethodOptions)
+	Router.HandleFunc("/tus/{uploadid}", Authenticated(TusHead)).Methods(http.MethodHead)
+	Router.HandleFunc("/tus/{uploadid}", Authenticated(TusPatch)).Methods(http.MethodPatch)
+	Router.HandleFunc("/tus/{uploadid}", Authenticated(TusTerminate)).Methods(http.MethodDelete)
+	Router.HandleFunc("/path/{b64path}/mkdir", Authenticated(CreateDirectory)).Methods(http.MethodPost)
+	Router.HandleFunc("/path/{b64path}/rename", Authenticated(RenameItem)).Methods(http.MethodPost)
+	Router.HandleFunc("/path/{b64path}/move", Authenticated(MoveItem)).Methods(http.MethodPost)
+	Router.HandleFunc("/path/{b64path}/copy", Authenticated(CopyItem)).Methods(http.MethodPost)
+	Router.HandleFunc("/path/{b64path}", Authenticated(DeleteItem)).Methods(http.MethodDelete)
+	Router.HandleFunc("/trash", Authenticated(ListTrash)).Methods(http.MethodGet)
+	Router.HandleFunc("/trash", Authenticated(PurgeTrash)).Methods(http.MethodDelete)
+	Router.HandleFunc("/trash/{trashid}", Authenticated(PurgeTrashItem)).Methods(http.MethodDelete)
+	Router.HandleFunc("/trash/{trashid}/restore", Authenticated(RestoreTrashItem)).Methods(http.MethodPost)
 
 	Walk()
+	touchRouteMetrics()
+}
+
+// InitializeStorage mounts the configured storages. Named mounts replace the local disk paths
+// with a virtual tree where every mount is a top directory.
+func InitializeStorage() {
+	if mount := config.Get("storage.s3.mount"); len(mount) > 0 {
+		s3 := newS3Storage(config.Get("storage.s3.bucket"), config.Get("storage.s3.prefix"))
+		if err := model.Mount(mount, s3); err != nil {
+			panic(err)
+		}
+		log.Infof("Serving bucket %s at %s", config.Get("storage.s3.bucket"), mount)
+	}
+
+	mounts := config.Get("media.mounts")
+	if len(mounts) == 0 {
+		return
+	}
+	for _, m := range strings.Split(mounts, ",") {
+		name, target, ok := strings.Cut(strings.TrimSpace(m), "=")
+		if !ok {
+			panic(fmt.Sprintf("invalid media.mounts entry %s. expecting name=target", m))
+		}
+		if err := model.ValidateName(name); err != nil {
+			panic(fmt.Sprintf("invalid mount name %s. got %s", name, err.Error()))
+		}
+		store, err := newStorage(target)
+		if err != nil {
+			panic(err)
+		}
+		if err := model.Mount("/"+name, store); err != nil {
+			panic(err)
+		}
+		log.Infof("Mounting %s as %s", target, name)
+	}
+	model.Resolve = model.ResolveNamespace
+}
+
+// newStorage opens the storage of a mount target, either "s3://bucket/prefix" or a local directory
+func newStorage(target string) (storage.Storage, error) {
+	if strings.HasPrefix(target, "s3://") {
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(target, "s3://"), "/")
+		return newS3Storage(bucket, prefix), nil
+	}
+	dir, err := filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+	inf, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !inf.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", target)
+	}
+	return storage.NewLocal(dir), nil
+}
+
+func newS3Storage(bucket, prefix string) *storage.S3 {
+	return storage.NewS3(storage.S3Config{
+		Endpoint:  config.Get("storage.s3.endpoint"),
+		Region:    config.Get("storage.s3.region"),
+		Bucket:    bucket,
+		Prefix:    prefix,
+		AccessKey: config.Get("storage.s3.access.key"),
+		SecretKey: config.Get("storage.s3.secret.key"),
+	}, nil)
+}
+
+// libraryRoots lists the media roots of the library: the mount points along with media.roots,
+// or only the mount points when named mounts are configured as nothing outside of them resolves
+func libraryRoots() []string {
+	roots := strings.Split(config.Get("media.roots"), ",")
+	if mounts := model.MountPoints(); len(mounts) > 0 {
+		if len(config.Get("media.roots")) == 0 || len(config.Get("media.mounts")) > 0 {
+			roots = mounts
+		} else {
+			roots = append(roots, mounts...)
+		}
+	}
+	return roots
+}
+
+// InitializeLibrary indexes all configured media roots and keep the index current
+func InitializeLibrary() {
+	model.Library = model.NewMediaIndex(libraryRoots()...)
+	log.Infof("Indexing media roots %s", strings.Join(model.Library.Roots(), ","))
+	if err := model.Library.Scan(); err != nil {
+		log.Errorf("Failed to index media roots. Got %s", err.Error())
+	}
+	rescan, err := jiffy.DurationOf(config.Get("media.index.rescan"))
+	if err != nil {
+		panic(err)
+	}
+	model.SubscribeChanges(model.Library.OnChange)
+	model.SetManifestCacheSize(config.GetInt("media.manifest.cache"))
+	model.SubscribeChanges(model.OnManifestChange)
+	model.Library.StartScanner(rescan)
+	if config.GetBoolean("media.index.watch") {
+		if err := model.Library.StartWatcher(); err != nil {
+			log.Errorf("Failed to watch media roots. Got %s", err.Error())
+		}
+	}
+
+	retention, err := jiffy.DurationOf(config.Get("media.trash.retention"))
+	if err != nil {
+		panic(err)
+	}
+	purgeInterval, err := jiffy.DurationOf(config.Get("media.trash.purge.interval"))
+	if err != nil {
+		panic(err)
+	}
+	trashPurger = model.NewTrashPurger(model.Library.Roots(), retention)
+	trashPurger.Start(purgeInterval)
+
+	InitializeChunkIndex()
+}
+
+// InitializeChunkIndex indexes the chunks of every file of the library, in the background, so /chunks
+// serves them by hash. Files read afterward are indexed as their manifest is made.
+func InitializeChunkIndex() {
+	if !config.GetBoolean("media.chunks.index") {
+		return
+	}
+	chunking, err := model.ParseChunking(config.Get("media.chunks.chunking"))
+	if err != nil {
+		panic(err)
+	}
+	model.Chunks = model.NewChunkIndex(chunking)
+	model.SubscribeChanges(model.Chunks.OnChange)
+	go model.Chunks.IndexLibrary(model.Library)
+}
+
+// InitializeUploads prepares the staging area of resumable uploads
+func InitializeUploads() {
+	stagingDir := config.Get("upload.staging.dir")
+	if len(stagingDir) == 0 {
+		stagingDir = filepath.Join(os.TempDir(), "adverter-upload")
+	}
+	expiry, err := jiffy.DurationOf(config.Get("upload.session.expiry"))
+	if err != nil {
+		panic(err)
+	}
+	model.Uploads, err = model.NewUploadManager(stagingDir, expiry)
+	if err != nil {
+		log.Errorf("Failed to prepare upload staging directory %s. Got %s", stagingDir, err.Error())
+	} else {
+		model.Uploads.MaxSize = int64(config.GetInt("upload.maxsize"))
+	}
+	model.TusUploads, err = model.NewTusManager(filepath.Join(stagingDir, "tus"), expiry)
+	if err != nil {
+		log.Errorf("Failed to prepare tus staging directory %s. Got %s", stagingDir, err.Error())
+	}
 }
 
 func configureLogging() {
@@ -58,8 +253,14 @@ func configureLogging() {
 func Start() {
 	configureLogging()
 	log.Infof("Starting Server")
-	startTime := time.Now()
+	startTime = time.Now()
+	if err := ValidateConfig(); err != nil {
+		log.Fatalf("Invalid configuration. Got %s", err.Error())
+	}
 
+	InitializeStorage()
+	InitializeLibrary()
+	InitializeUploads()
 	InitializeRouter()
 
 	var wait time.Duration
@@ -83,6 +284,11 @@ func Start() {
 
 	wait = graceShut
 
+	unready, err := jiffy.DurationOf(config.Get("server.timeout.unready"))
+	if err != nil {
+		panic(err)
+	}
+
 	address := fmt.Sprintf("%s:%s", config.Get("server.host"), config.Get("server.port"))
 	log.Info("Server binding to ", address)
 
@@ -93,6 +299,7 @@ func Start() {
 		ReadTimeout:  ReadTimeout,
 		IdleTimeout:  IdleTimeout,
 		Handler:      Router, // Pass our instance of gorilla/mux in.
+		ConnState:    trackConnections,
 	}
 	// Run our server in a goroutine so that it doesn't block.
 	go func() {
@@ -102,19 +309,29 @@ func Start() {
 	}()
 
 	c := make(chan os.Signal, 1)
-	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
-	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-	signal.Notify(c, os.Interrupt)
+	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C) or SIGTERM
+	// SIGKILL and SIGQUIT (Ctrl+/) will not be caught.
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	// Block until we receive our signal.
 	<-c
 
+	// Report not ready first, so load balancers stop sending requests before the listener closes.
+	shuttingDown.Store(true)
+	time.Sleep(unready)
+
 	// Create a deadline to wait for.
 	ctx, cancel := context.WithTimeout(context.Background(), wait)
 	defer cancel()
 	// Doesn't block if no connections, but will otherwise wait
 	// until the timeout deadline.
 	srv.Shutdown(ctx)
+	if model.Library != nil {
+		model.Library.Stop()
+	}
+	if trashPurger != nil {
+		trashPurger.Stop()
+	}
 	// Optionally, you could run srv.Shutdown in a goroutine and block on
 	// <-ctx.Done() if your application should wait for other services
 	// to finalize based on context cancellation.
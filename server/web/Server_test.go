@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/config"
 	"github.com/newm4n/Adverter/server/web/model"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 )
 
@@ -21,7 +23,7 @@ func TestServerEndpoint(t *testing.T) {
 	Router.HandleFunc("/path/{b64path}/chunk/{chunkno}", GetChunkData).Methods(http.MethodGet)
 
 	t.Run("Testing file listing", func(t *testing.T) {
-		dirToList := "C:\\Users\\ferdi\\Workspace\\Golang\\src\\github.com\\newm4n\\Adverter\\sample"
+		dirToList := filepath.Join("..", "..", "sample")
 		pi := model.PathInfo{Path: dirToList}
 		str := pi.ToPathInfoString()
 		pathToTest := fmt.Sprintf("/path/%s/files", str)
@@ -39,7 +41,7 @@ func TestServerEndpoint(t *testing.T) {
 		t.Logf("GOT : %s", body)
 	})
 	t.Run("Testing directory listing", func(t *testing.T) {
-		dirToList := "C:\\Users\\ferdi\\Workspace\\Golang\\src\\github.com\\newm4n\\Adverter"
+		dirToList := filepath.Join("..", "..")
 		pi := model.PathInfo{Path: dirToList}
 		str := pi.ToPathInfoString()
 		pathToTest := fmt.Sprintf("/path/%s/directories", str)
@@ -57,7 +59,7 @@ func TestServerEndpoint(t *testing.T) {
 		t.Logf("GOT : %s", body)
 	})
 	t.Run("Testing file info listing", func(t *testing.T) {
-		dirToList := "C:\\Users\\ferdi\\Workspace\\Golang\\src\\github.com\\newm4n\\Adverter\\sample\\file_example_MP4_640_3MG.mp4"
+		dirToList := filepath.Join("..", "..", "sample", "file_example_MP4_640_3MG.mp4")
 		pi := model.PathInfo{Path: dirToList}
 		str := pi.ToPathInfoString()
 		pathToTest := fmt.Sprintf("/path/%s/chunk/info", str)
@@ -75,7 +77,7 @@ func TestServerEndpoint(t *testing.T) {
 		t.Logf("GOT : %s", body)
 	})
 	t.Run("Testing file chunk listing", func(t *testing.T) {
-		dirToList := "C:\\Users\\ferdi\\Workspace\\Golang\\src\\github.com\\newm4n\\Adverter\\sample\\file_example_MP4_640_3MG.mp4"
+		dirToList := filepath.Join("..", "..", "sample", "file_example_MP4_640_3MG.mp4")
 		pi := model.PathInfo{Path: dirToList}
 		str := pi.ToPathInfoString()
 		for i := 0; i < 32; i++ {
@@ -102,3 +104,26 @@ func TestServerEndpoint(t *testing.T) {
 		}
 	})
 }
+
+func TestMixedRootsAndMounts(t *testing.T) {
+	useTokenKey(t)
+	local := t.TempDir()
+	config.Set("media.roots", local)
+	config.Set("media.mounts", "campaigns="+t.TempDir())
+	defer func() {
+		config.Set("media.roots", "")
+		config.Set("media.mounts", "")
+		model.Unmount("/campaigns")
+		model.Resolve = model.ResolveMounted
+	}()
+	assert.Error(t, ValidateConfig())
+
+	InitializeStorage()
+	assert.Equal(t, []string{"/campaigns"}, libraryRoots())
+	library := model.NewMediaIndex(libraryRoots()...)
+	assert.False(t, library.Contains(filepath.Join(local, "intro.mp4")))
+	assert.True(t, library.Contains("/campaigns/intro.mp4"))
+
+	config.Set("media.mounts", "")
+	assert.NoError(t, ValidateConfig())
+}
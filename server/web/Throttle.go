@@ -0,0 +1,421 @@
+package web
+
+import (
+	"fmt"
+	"github.com/newm4n/Adverter/server/config"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ThrottleLimits are download rates in bytes per second, 0 meaning unlimited
+type ThrottleLimits struct {
+	Global int64
+	Client int64
+	IP     int64
+}
+
+// ThrottleWindow applies its limits between From and To, minutes since midnight, wrapping around midnight
+// when To is before From
+type ThrottleWindow struct {
+	From   int
+	To     int
+	Limits ThrottleLimits
+}
+
+// Throttle shares download bandwidth between all requests, each client and each IP
+type Throttle struct {
+	base     ThrottleLimits
+	schedule []*ThrottleWindow
+	global   *tokenBucket
+	clients  *bucketSet
+	ips      *bucketSet
+	now      func() time.Time
+}
+
+var (
+	throttle     *Throttle
+	throttleOnce sync.Once
+)
+
+// NewThrottle creates a throttle applying base limits outside of every window of the schedule
+func NewThrottle(base ThrottleLimits, schedule []*ThrottleWindow) *Throttle {
+	return &Throttle{
+		base:     base,
+		schedule: schedule,
+		global:   newTokenBucket(0, 0),
+		clients:  newBucketSet(),
+		ips:      newBucketSet(),
+		now:      time.Now,
+	}
+}
+
+// Limits returns the limits in force at t, those of the first window of the schedule holding t
+func (th *Throttle) Limits(t time.Time) ThrottleLimits {
+	minute := t.Hour()*60 + t.Minute()
+	for _, window := range th.schedule {
+		if window.From <= window.To && minute >= window.From && minute < window.To {
+			return window.Limits
+		}
+		if window.From > window.To && (minute >= window.From || minute < window.To) {
+			return window.Limits
+		}
+	}
+	return th.base
+}
+
+// wait blocks until n bytes may be sent to the client and IP, honouring every limit
+func (th *Throttle) wait(r *http.Request, client, ip string, n int) error {
+	limits := th.Limits(th.now())
+	buckets := make([]*tokenBucket, 0, 3)
+	if limits.Global > 0 {
+		buckets = append(buckets, th.global.withRate(limits.Global))
+	}
+	if limits.Client > 0 && len(client) > 0 {
+		buckets = append(buckets, th.clients.get(client).withRate(limits.Client))
+	}
+	if limits.IP > 0 && len(ip) > 0 {
+		buckets = append(buckets, th.ips.get(ip).withRate(limits.IP))
+	}
+	for _, bucket := range buckets {
+		if err := bucket.take(r, float64(n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// throttleOf builds the throttle from configuration, once
+func throttleOf() *Throttle {
+	throttleOnce.Do(func() {
+		var err error
+		if throttle, err = loadThrottle(); err != nil {
+			panic(err)
+		}
+	})
+	return throttle
+}
+
+// loadThrottle reads the server.throttle.* configuration
+func loadThrottle() (*Throttle, error) {
+	base := ThrottleLimits{}
+	var err error
+	if base.Global, err = ParseByteSize(config.Get("server.throttle.global")); err != nil {
+		return nil, err
+	}
+	if base.Client, err = ParseByteSize(config.Get("server.throttle.client")); err != nil {
+		return nil, err
+	}
+	if base.IP, err = ParseByteSize(config.Get("server.throttle.ip")); err != nil {
+		return nil, err
+	}
+	schedule, err := ParseThrottleSchedule(config.Get("server.throttle.schedule"), base)
+	if err != nil {
+		return nil, err
+	}
+	return NewThrottle(base, schedule), nil
+}
+
+// Throttled wraps a download handler so its response is sent no faster than the limits configured
+// with server.throttle.* allow
+func Throttled(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !config.GetBoolean("server.throttle.enable") {
+			next(w, r)
+			return
+		}
+		next(&throttledWriter{
+			ResponseWriter: w,
+			throttle:       throttleOf(),
+			request:        r,
+			client:         clientKey(r),
+			ip:             clientIP(r),
+		}, r)
+	}
+}
+
+type throttledWriter struct {
+	http.ResponseWriter
+	throttle *Throttle
+	request  *http.Request
+	client   string
+	ip       string
+}
+
+// throttleSlice is the most bytes written at once, so a slow limit paces a large write
+const throttleSlice = 16 * 1024
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		end := written + throttleSlice
+		if end > len(p) {
+			end = len(p)
+		}
+		if err := tw.throttle.wait(tw.request, tw.client, tw.ip, end-written); err != nil {
+			return written, err
+		}
+		n, err := tw.ResponseWriter.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (tw *throttledWriter) Flush() {
+	if flusher, ok := tw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (tw *throttledWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// tokenBucket holds up to capacity tokens, refilled at rate tokens per second
+type tokenBucket struct {
+	mutex    sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+	lastUsed time.Time
+}
+
+// newTokenBucket creates a full bucket
+func newTokenBucket(rate, capacity float64) *tokenBucket {
+	now := time.Now()
+	return &tokenBucket{rate: rate, capacity: capacity, tokens: capacity, last: now, lastUsed: now}
+}
+
+// withRate changes the rate of the bucket, holding one second worth of tokens, as the schedule moves
+// to another window
+func (b *tokenBucket) withRate(rate int64) *tokenBucket {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.rate == 0 {
+		// a new bucket starts full
+		b.rate, b.capacity, b.tokens, b.last = float64(rate), float64(rate), float64(rate), time.Now()
+	} else if b.rate != float64(rate) {
+		b.refill(time.Now())
+		b.rate, b.capacity = float64(rate), float64(rate)
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+	}
+	return b
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
+
+// reserve takes n tokens, going into debt if needed, and tells how long to wait for the debt to be paid
+func (b *tokenBucket) reserve(n float64) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	b.refill(now)
+	b.lastUsed = now
+	b.tokens -= n
+	if b.tokens >= 0 || b.rate <= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// allow takes n tokens if the bucket holds them, otherwise tells how long until it does
+func (b *tokenBucket) allow(n float64) (bool, time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	b.refill(now)
+	b.lastUsed = now
+	if b.tokens >= n {
+		b.tokens -= n
+		return true, 0
+	}
+	if b.rate <= 0 {
+		return false, time.Hour
+	}
+	return false, time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// take waits until n tokens are available, or the request is cancelled
+func (b *tokenBucket) take(r *http.Request, n float64) error {
+	wait := b.reserve(n)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-r.Context().Done():
+		return r.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// bucketSet holds a bucket per key, forgetting the buckets left unused for a while
+type bucketSet struct {
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+func newBucketSet() *bucketSet {
+	return &bucketSet{buckets: make(map[string]*tokenBucket), lastPrune: time.Now()}
+}
+
+// get returns the bucket of key, an empty one meant for withRate when new
+func (set *bucketSet) get(key string) *tokenBucket {
+	return set.getOrCreate(key, 0, 0)
+}
+
+// getOrCreate returns the bucket of key, a full one of the specified rate and capacity when new
+func (set *bucketSet) getOrCreate(key string, rate, capacity float64) *tokenBucket {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(set.lastPrune) > time.Minute {
+		for k, bucket := range set.buckets {
+			bucket.mutex.Lock()
+			idle := now.Sub(bucket.lastUsed) > time.Minute
+			bucket.mutex.Unlock()
+			if idle {
+				delete(set.buckets, k)
+			}
+		}
+		set.lastPrune = now
+	}
+	bucket, ok := set.buckets[key]
+	if !ok {
+		bucket = newTokenBucket(rate, capacity)
+		set.buckets[key] = bucket
+	}
+	return bucket
+}
+
+// clientIdentity names the client of a request by the subject of its bearer token, empty when it has
+// no valid token. Headers the client sets freely, such as X-Client-ID, are not trusted.
+func clientIdentity(r *http.Request) string {
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		if claims, err := VerifyToken(strings.TrimSpace(authHeader[len("Bearer "):])); err == nil {
+			return "sub:" + claims.Subject
+		}
+	}
+	return ""
+}
+
+// clientKey names the client of a request for its limits: clientIdentity, or its IP when anonymous
+func clientKey(r *http.Request) string {
+	if client := clientIdentity(r); len(client) > 0 {
+		return client
+	}
+	return "ip:" + clientIP(r)
+}
+
+// clientIP returns the address of the client of a request, taken from X-Forwarded-For or X-Real-IP
+// when server.http.trust.proxy is set
+func clientIP(r *http.Request) string {
+	if config.GetBoolean("server.http.trust.proxy") {
+		if forwarded := r.Header.Get("X-Forwarded-For"); len(forwarded) > 0 {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+		if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); len(realIP) > 0 {
+			return realIP
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ParseByteSize reads a size in bytes with an optional kb, mb or gb suffix, powers of 1024, eg. "512kb"
+func ParseByteSize(size string) (int64, error) {
+	size = strings.ToLower(strings.TrimSpace(size))
+	if len(size) == 0 {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	for suffix, m := range map[string]int64{"kb": 1 << 10, "mb": 1 << 20, "gb": 1 << 30} {
+		if strings.HasSuffix(size, suffix) {
+			multiplier = m
+			size = strings.TrimSpace(strings.TrimSuffix(size, suffix))
+			break
+		}
+	}
+	size = strings.TrimSuffix(size, "b")
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %s", size)
+	}
+	return n * multiplier, nil
+}
+
+// ParseThrottleSchedule reads windows separated by semicolons, each of them a time range followed by the
+// limits changed in that window, eg. "07:00-22:00 global=2mb client=256kb; 22:00-07:00 global=0".
+// Limits not named in a window are those of base.
+func ParseThrottleSchedule(schedule string, base ThrottleLimits) ([]*ThrottleWindow, error) {
+	windows := make([]*ThrottleWindow, 0)
+	for _, item := range strings.Split(schedule, ";") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		from, to, ok := strings.Cut(fields[0], "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid throttle window %s. expecting HH:MM-HH:MM", fields[0])
+		}
+		window := &ThrottleWindow{Limits: base}
+		var err error
+		if window.From, err = parseClock(from); err != nil {
+			return nil, err
+		}
+		if window.To, err = parseClock(to); err != nil {
+			return nil, err
+		}
+		for _, field := range fields[1:] {
+			name, value, _ := strings.Cut(field, "=")
+			limit, err := ParseByteSize(value)
+			if err != nil {
+				return nil, err
+			}
+			switch name {
+			case "global":
+				window.Limits.Global = limit
+			case "client":
+				window.Limits.Client = limit
+			case "ip":
+				window.Limits.IP = limit
+			default:
+				return nil, fmt.Errorf("unknown throttle limit %s", name)
+			}
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// parseClock reads HH:MM as minutes since midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %s. expecting HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,50 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseThrottleSchedule(t *testing.T) {
+	size, err := ParseByteSize("512kb")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(512*1024), size)
+	_, err = ParseByteSize("fast")
+	assert.Error(t, err)
+
+	base := ThrottleLimits{Global: 10 << 20}
+	schedule, err := ParseThrottleSchedule("07:00-22:00 global=2mb client=256kb; 22:00-07:00 ip=1mb", base)
+	assert.NoError(t, err)
+	assert.Len(t, schedule, 2)
+
+	th := NewThrottle(base, schedule)
+	day := th.Limits(time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local))
+	assert.Equal(t, ThrottleLimits{Global: 2 << 20, Client: 256 << 10}, day)
+	night := th.Limits(time.Date(2024, 5, 1, 3, 0, 0, 0, time.Local))
+	assert.Equal(t, ThrottleLimits{Global: 10 << 20, IP: 1 << 20}, night)
+
+	_, err = ParseThrottleSchedule("07:00 global=1mb", base)
+	assert.Error(t, err)
+	_, err = ParseThrottleSchedule("07:00-08:00 speed=1mb", base)
+	assert.Error(t, err)
+}
+
+func TestThrottledWriter(t *testing.T) {
+	th := NewThrottle(ThrottleLimits{IP: 1 << 20}, nil)
+	request := httptest.NewRequest(http.MethodGet, "/chunks/abc", nil)
+	send := func(ip string) time.Duration {
+		tw := &throttledWriter{ResponseWriter: httptest.NewRecorder(), throttle: th, request: request, ip: ip}
+		start := time.Now()
+		n, err := tw.Write(make([]byte, 3<<19))
+		assert.NoError(t, err)
+		assert.Equal(t, 3<<19, n)
+		return time.Since(start)
+	}
+	// a full second of burst, then half a second worth of bytes
+	assert.GreaterOrEqual(t, send("10.0.0.1"), 400*time.Millisecond)
+	// another IP has its own bucket
+	assert.Less(t, send("10.0.0.2"), 700*time.Millisecond)
+}
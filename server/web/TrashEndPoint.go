@@ -0,0 +1,167 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/hyperjumptech/jiffy"
+	"github.com/newm4n/Adverter/server/web/model"
+	"net/http"
+	"time"
+)
+
+type TrashItemRespond struct {
+	ID           string
+	Root         string
+	Name         string
+	OriginalPath string
+	IsDir        bool
+	DeletedAt    time.Time
+	URL          string
+}
+
+type TrashPurgeRespond struct {
+	Purged int
+}
+
+// Router.Handle("/trash", ListTrash)
+// The root query parameter limits the listing to the trash of a single media root.
+func ListTrash(w http.ResponseWriter, r *http.Request) {
+	roots, ok := trashRootsOf(w, r)
+	if !ok {
+		return
+	}
+	ret := make([]*TrashItemRespond, 0)
+	for _, root := range roots {
+		items, err := model.ListTrash(root)
+		if err != nil {
+			writeModelError(w, r, err)
+			return
+		}
+		for _, item := range items {
+			ret = append(ret, newTrashItemRespond(item))
+		}
+	}
+	retBytes, err := json.Marshal(ret)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(retBytes)
+}
+
+// Router.Handle("/trash/{trashid}/restore", RestoreTrashItem)
+func RestoreTrashItem(w http.ResponseWriter, r *http.Request) {
+	item, ok := trashItemOf(w, r)
+	if !ok {
+		return
+	}
+	if err := item.Restore(); err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	writeMovedItem(w, r, item.OriginalPath)
+}
+
+// Router.Handle("/trash/{trashid}", PurgeTrashItem)
+func PurgeTrashItem(w http.ResponseWriter, r *http.Request) {
+	item, ok := trashItemOf(w, r)
+	if !ok {
+		return
+	}
+	if err := item.Purge(); err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Router.Handle("/trash", PurgeTrash)
+// Without the olderThan query parameter, eg. "7 days", the whole trash is emptied.
+// The root query parameter limits the purge to the trash of a single media root.
+func PurgeTrash(w http.ResponseWriter, r *http.Request) {
+	roots, ok := trashRootsOf(w, r)
+	if !ok {
+		return
+	}
+	var olderThan time.Duration
+	if param := r.URL.Query().Get("olderThan"); len(param) > 0 {
+		var err error
+		olderThan, err = jiffy.DurationOf(param)
+		if err != nil {
+			writeInvalidParam(w, r, err)
+			return
+		}
+	}
+	ret := &TrashPurgeRespond{}
+	for _, root := range roots {
+		purged, err := model.PurgeTrash(root, olderThan)
+		if err != nil {
+			writeModelError(w, r, err)
+			return
+		}
+		ret.Purged += purged
+	}
+	retBytes, err := json.Marshal(ret)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(retBytes)
+}
+
+func trashRootsOf(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	if model.Library == nil {
+		writeError(w, r, http.StatusServiceUnavailable, CodeUnavailable, "media library is not available", "")
+		return nil, false
+	}
+	root := r.URL.Query().Get("root")
+	if len(root) == 0 {
+		return model.Library.Roots(), true
+	}
+	if !model.Library.IsRoot(root) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "not found", fmt.Sprintf("%s is not a media root", root))
+		return nil, false
+	}
+	return []string{model.Library.RootOf(root)}, true
+}
+
+func trashItemOf(w http.ResponseWriter, r *http.Request) (*model.TrashItem, bool) {
+	id := mux.Vars(r)["trashid"]
+	if model.Library != nil {
+		for _, root := range model.Library.Roots() {
+			if item, err := model.GetTrashItem(root, id); err == nil {
+				return item, true
+			}
+		}
+	}
+	writeError(w, r, http.StatusNotFound, CodeNotFound, "not found", fmt.Sprintf("trash item %s not found", id))
+	return nil, false
+}
+
+func writeTrashItem(w http.ResponseWriter, r *http.Request, status int, item *model.TrashItem) {
+	retBytes, err := json.Marshal(newTrashItemRespond(item))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(retBytes)
+}
+
+func newTrashItemRespond(item *model.TrashItem) *TrashItemRespond {
+	return &TrashItemRespond{
+		ID:           item.ID,
+		Root:         item.Root,
+		Name:         item.Name,
+		OriginalPath: item.OriginalPath,
+		IsDir:        item.IsDir,
+		DeletedAt:    item.DeletedAt,
+		URL:          fmt.Sprintf("/trash/%s", item.ID),
+	}
+}
@@ -0,0 +1,198 @@
+package web
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/config"
+	"github.com/newm4n/Adverter/server/web/model"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	TusVersion    = "1.0.0"
+	TusExtensions = "creation,termination,checksum"
+
+	// StatusChecksumMismatch is the tus checksum extension status for a chunk failing its Upload-Checksum
+	StatusChecksumMismatch = 460
+)
+
+// Router.Handle("/tus", TusOptions)
+func TusOptions(w http.ResponseWriter, r *http.Request) {
+	algorithms := make([]string, 0, len(model.TusChecksumAlgorithms))
+	for algo := range model.TusChecksumAlgorithms {
+		algorithms = append(algorithms, algo)
+	}
+	sort.Strings(algorithms)
+	w.Header().Set("Tus-Resumable", TusVersion)
+	w.Header().Set("Tus-Version", TusVersion)
+	w.Header().Set("Tus-Extension", TusExtensions)
+	w.Header().Set("Tus-Checksum-Algorithm", strings.Join(algorithms, ","))
+	if maxSize := config.GetInt("upload.tus.maxsize"); maxSize > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.Itoa(maxSize))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Router.Handle("/tus", TusCreate)
+// Router.Handle("/path/{b64path}/tus", TusCreate)
+// The target directory is taken from the path, or from the "directory" metadata when posted to /tus.
+// The file name is taken from the "filename" metadata.
+func TusCreate(w http.ResponseWriter, r *http.Request) {
+	if !tusPrecondition(w, r) {
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParam, "invalid param", "invalid Upload-Length")
+		return
+	}
+	if maxSize := config.GetInt("upload.tus.maxsize"); maxSize > 0 && length > int64(maxSize) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, CodeTooLarge, "upload too large", fmt.Sprintf("upload exceeds %d bytes", maxSize))
+		return
+	}
+	metadata, err := model.ParseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	dirPath := metadata["directory"]
+	if b64Path, ok := mux.Vars(r)["b64path"]; ok {
+		pathInfo, err := model.NewPathInfoFromBase64(b64Path)
+		if err != nil {
+			writeInvalidParam(w, r, err)
+			return
+		}
+		dirPath = pathInfo.Path
+	}
+	if !writable(dirPath) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "access denied", fmt.Sprintf("%s is outside of media roots", dirPath))
+		return
+	}
+	tDir, err := model.NewTheDirectory(dirPath)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	upload, err := model.TusUploads.Create(tDir, metadata["filename"], length, metadata)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/tus/%s", config.Get("upload.tus.baseurl"), upload.ID))
+	w.Header().Set("Upload-Offset", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Router.Handle("/tus/{uploadid}", TusHead)
+func TusHead(w http.ResponseWriter, r *http.Request) {
+	upload, ok := tusUploadOf(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.CurrentOffset(), 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if len(upload.Metadata) > 0 {
+		w.Header().Set("Upload-Metadata", upload.EncodedMetadata())
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Router.Handle("/tus/{uploadid}", TusPatch)
+func TusPatch(w http.ResponseWriter, r *http.Request) {
+	upload, ok := tusUploadOf(w, r)
+	if !ok {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		writeError(w, r, http.StatusUnsupportedMediaType, CodeUnsupported, "unsupported content type",
+			"content type must be application/offset+octet-stream")
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParam, "invalid param", "invalid Upload-Offset")
+		return
+	}
+	algorithm := ""
+	var checksum []byte
+	if header := r.Header.Get("Upload-Checksum"); len(header) > 0 {
+		parts := strings.Fields(header)
+		if len(parts) != 2 {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidParam, "invalid param", "invalid Upload-Checksum")
+			return
+		}
+		if _, ok := model.TusChecksumAlgorithms[parts[0]]; !ok {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidParam, "invalid param", fmt.Sprintf("unsupported checksum algorithm %s", parts[0]))
+			return
+		}
+		algorithm = parts[0]
+		checksum, err = base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidParam, "invalid param", "invalid Upload-Checksum")
+			return
+		}
+	}
+
+	newOffset, err := upload.Append(offset, r.Body, algorithm, checksum)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	switch {
+	case errors.Is(err, model.ErrTusOffsetMismatch):
+		writeError(w, r, http.StatusConflict, CodeConflict, "offset mismatch", err.Error())
+	case errors.Is(err, model.ErrTusChecksumMismatch):
+		writeError(w, r, StatusChecksumMismatch, CodeChecksumMismatch, "checksum mismatch", err.Error())
+	case errors.Is(err, model.ErrTusLandFailed) && errors.Is(err, model.ErrExist):
+		writeError(w, r, http.StatusConflict, CodeConflict, "already exist", err.Error())
+	case errors.Is(err, model.ErrTusLandFailed):
+		writeInternalError(w, r, err)
+	case err != nil:
+		writeModelError(w, r, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Router.Handle("/tus/{uploadid}", TusTerminate)
+func TusTerminate(w http.ResponseWriter, r *http.Request) {
+	upload, ok := tusUploadOf(w, r)
+	if !ok {
+		return
+	}
+	if err := model.TusUploads.Terminate(upload.ID); err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusPrecondition sets the Tus-Resumable header and reject clients speaking another protocol version
+func tusPrecondition(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", TusVersion)
+	if model.TusUploads == nil {
+		writeError(w, r, http.StatusServiceUnavailable, CodeUnavailable, "tus upload is not available", "")
+		return false
+	}
+	if r.Header.Get("Tus-Resumable") != TusVersion {
+		w.Header().Set("Tus-Version", TusVersion)
+		writeError(w, r, http.StatusPreconditionFailed, CodeUnsupported, "unsupported tus version", "")
+		return false
+	}
+	return true
+}
+
+func tusUploadOf(w http.ResponseWriter, r *http.Request) (*model.TusUpload, bool) {
+	if !tusPrecondition(w, r) {
+		return nil, false
+	}
+	upload, err := model.TusUploads.Get(mux.Vars(r)["uploadid"])
+	if err != nil {
+		writeModelError(w, r, err)
+		return nil, false
+	}
+	return upload, true
+}
@@ -0,0 +1,160 @@
+package web
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/web/model"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTusUpload(t *testing.T) {
+	root := t.TempDir()
+	model.Library = model.NewMediaIndex(root)
+	defer func() { model.Library = nil }()
+	var err error
+	model.TusUploads, err = model.NewTusManager(t.TempDir(), time.Hour)
+	assert.NoError(t, err)
+	defer func() { model.TusUploads = nil }()
+
+	Router = mux.NewRouter()
+	Router.HandleFunc("/tus", TusOptions).Methods(http.MethodOptions)
+	Router.HandleFunc("/tus", TusCreate).Methods(http.MethodPost)
+	Router.HandleFunc("/tus/{uploadid}", TusHead).Methods(http.MethodHead)
+	Router.HandleFunc("/tus/{uploadid}", TusPatch).Methods(http.MethodPatch)
+	Router.HandleFunc("/tus/{uploadid}", TusTerminate).Methods(http.MethodDelete)
+
+	tusRequest := func(method, path string, body string, headers map[string]string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Tus-Resumable", TusVersion)
+		for k, v := range headers {
+			request.Header.Set(k, v)
+		}
+		response := httptest.NewRecorder()
+		Router.ServeHTTP(response, request)
+		return response
+	}
+	b64 := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+
+	response := tusRequest(http.MethodOptions, "/tus", "", nil)
+	assert.Equal(t, http.StatusNoContent, response.Code)
+	assert.Contains(t, response.Header().Get("Tus-Extension"), "checksum")
+
+	response = tusRequest(http.MethodPost, "/tus", "", map[string]string{
+		"Upload-Length":   "11",
+		"Upload-Metadata": "filename " + b64("escape.txt") + ",directory " + b64(os.TempDir()),
+	})
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	response = tusRequest(http.MethodPost, "/tus", "", map[string]string{
+		"Upload-Length":   "11",
+		"Upload-Metadata": "filename " + b64(model.TrashDirName) + ",directory " + b64(root),
+	})
+	assert.Equal(t, http.StatusForbidden, response.Code)
+
+	response = tusRequest(http.MethodPost, "/tus", "", map[string]string{
+		"Upload-Length":   "11",
+		"Upload-Metadata": "filename " + b64("hello.txt") + ",directory " + b64(root),
+	})
+	assert.Equal(t, http.StatusCreated, response.Code)
+	location := response.Header().Get("Location")
+	assert.True(t, strings.HasPrefix(location, "/tus/"))
+
+	patch := map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0"}
+	response = tusRequest(http.MethodPatch, location, "hello", patch)
+	assert.Equal(t, http.StatusNoContent, response.Code)
+	assert.Equal(t, "5", response.Header().Get("Upload-Offset"))
+
+	response = tusRequest(http.MethodPatch, location, " world", patch)
+	assert.Equal(t, http.StatusConflict, response.Code)
+
+	sum := md5.Sum([]byte("bogus!"))
+	patch["Upload-Offset"] = "5"
+	patch["Upload-Checksum"] = "md5 " + base64.StdEncoding.EncodeToString(sum[:])
+	response = tusRequest(http.MethodPatch, location, " world", patch)
+	assert.Equal(t, StatusChecksumMismatch, response.Code)
+
+	response = tusRequest(http.MethodHead, location, "", nil)
+	assert.Equal(t, "5", response.Header().Get("Upload-Offset"))
+	assert.Equal(t, "11", response.Header().Get("Upload-Length"))
+
+	sum = md5.Sum([]byte(" world"))
+	patch["Upload-Checksum"] = "md5 " + base64.StdEncoding.EncodeToString(sum[:])
+	response = tusRequest(http.MethodPatch, location, " world", patch)
+	assert.Equal(t, http.StatusNoContent, response.Code)
+
+	landed, err := os.ReadFile(filepath.Join(root, "hello.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(landed))
+
+	response = tusRequest(http.MethodDelete, location, "", nil)
+	assert.Equal(t, http.StatusNoContent, response.Code)
+	response = tusRequest(http.MethodHead, location, "", nil)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestTusHeadWhilePatchingAndLandFailure(t *testing.T) {
+	root := t.TempDir()
+	model.Library = model.NewMediaIndex(root)
+	defer func() { model.Library = nil }()
+	var err error
+	model.TusUploads, err = model.NewTusManager(t.TempDir(), time.Hour)
+	assert.NoError(t, err)
+	defer func() { model.TusUploads = nil }()
+
+	Router = mux.NewRouter()
+	Router.HandleFunc("/tus", TusCreate).Methods(http.MethodPost)
+	Router.HandleFunc("/tus/{uploadid}", TusHead).Methods(http.MethodHead)
+	Router.HandleFunc("/tus/{uploadid}", TusPatch).Methods(http.MethodPatch)
+	tusRequest := func(method, path string, body string, headers map[string]string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Tus-Resumable", TusVersion)
+		for k, v := range headers {
+			request.Header.Set(k, v)
+		}
+		response := httptest.NewRecorder()
+		Router.ServeHTTP(response, request)
+		return response
+	}
+
+	response := tusRequest(http.MethodPost, "/tus", "", map[string]string{
+		"Upload-Length":   "100",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("taken.txt")) + ",directory " + base64.StdEncoding.EncodeToString([]byte(root)),
+	})
+	assert.Equal(t, http.StatusCreated, response.Code)
+	location := response.Header().Get("Location")
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			tusRequest(http.MethodHead, location, "", nil)
+		}
+	}()
+	for offset := 0; offset < 90; offset += 10 {
+		response = tusRequest(http.MethodPatch, location, "0123456789", map[string]string{
+			"Content-Type": "application/offset+octet-stream", "Upload-Offset": strconv.Itoa(offset)})
+		assert.Equal(t, http.StatusNoContent, response.Code)
+	}
+	<-done
+
+	// the target appears before the last bytes arrive, the upload can not land
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "taken.txt"), []byte("first"), 0644))
+	response = tusRequest(http.MethodPatch, location, "0123456789", map[string]string{
+		"Content-Type": "application/offset+octet-stream", "Upload-Offset": "90"})
+	assert.Equal(t, http.StatusConflict, response.Code)
+	response = tusRequest(http.MethodHead, location, "", nil)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	kept, err := os.ReadFile(filepath.Join(root, "taken.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(kept))
+}
@@ -0,0 +1,223 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/config"
+	"github.com/newm4n/Adverter/server/web/model"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type UploadInitiateRequest struct {
+	Name      string
+	Size      int64
+	ChunkSize int
+	FileHash  string
+	Overwrite bool
+}
+
+type UploadFinalizeRequest struct {
+	FileHash string
+}
+
+type UploadSessionRespond struct {
+	ID         string
+	Name       string
+	Path       string
+	Size       int64
+	ChunkSize  int
+	ChunkCount int
+	Missing    []int
+	URL        string
+}
+
+// Router.Handle("/path/{b64path}/upload", InitiateUpload)
+func InitiateUpload(w http.ResponseWriter, r *http.Request) {
+	if model.Uploads == nil {
+		writeError(w, r, http.StatusServiceUnavailable, CodeUnavailable, "upload is not available", "")
+		return
+	}
+	varMap := mux.Vars(r)
+	b64Path := varMap["b64path"]
+	pathInfo, err := model.NewPathInfoFromBase64(b64Path)
+	if err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	if !writable(pathInfo.Path) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "access denied", fmt.Sprintf("%s is outside of media roots", pathInfo.Path))
+		return
+	}
+	tDir, err := model.NewTheDirectory(pathInfo.Path)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	initReq := &UploadInitiateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(initReq); err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	if maxChunk := config.GetInt("upload.chunk.max"); maxChunk > 0 && initReq.ChunkSize > maxChunk {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParam, "invalid param",
+			fmt.Sprintf("chunk size %d above the maximum of %d", initReq.ChunkSize, maxChunk))
+		return
+	}
+	session, err := model.Uploads.Initiate(tDir, initReq.Name, initReq.Size, initReq.ChunkSize, initReq.FileHash, initReq.Overwrite)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	writeUploadSession(w, r, http.StatusCreated, session)
+}
+
+// Router.Handle("/upload/{uploadid}", GetUpload)
+func GetUpload(w http.ResponseWriter, r *http.Request) {
+	session, ok := uploadSessionOf(w, r)
+	if !ok {
+		return
+	}
+	writeUploadSession(w, r, http.StatusOK, session)
+}
+
+// Router.Handle("/upload/{uploadid}/chunk/{chunkno}", PutUploadChunk)
+// The body is either a ChunkInfoRespond json, the same as the chunk download, or the raw
+// chunk bytes with their MD5 hash in the X-Chunk-Hash header.
+func PutUploadChunk(w http.ResponseWriter, r *http.Request) {
+	session, ok := uploadSessionOf(w, r)
+	if !ok {
+		return
+	}
+	chunkNo, err := strconv.Atoi(mux.Vars(r)["chunkno"])
+	if err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	// base64 inflates the chunk by a third, leave room for the json envelope as well.
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(session.ChunkSize)*2+1024))
+	if err != nil {
+		writeInvalidParam(w, r, err)
+		return
+	}
+	var data []byte
+	var hash string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		chunk := &ChunkInfoRespond{}
+		if err := json.Unmarshal(body, chunk); err != nil {
+			writeInvalidParam(w, r, err)
+			return
+		}
+		data, err = base64.StdEncoding.DecodeString(chunk.Base64)
+		if err != nil {
+			writeInvalidParam(w, r, err)
+			return
+		}
+		hash = chunk.Hash
+	} else {
+		data = body
+		hash = r.Header.Get("X-Chunk-Hash")
+	}
+	if err := session.PutChunk(chunkNo, data, hash); err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	writeUploadSession(w, r, http.StatusOK, session)
+}
+
+// Router.Handle("/upload/{uploadid}/finalize", FinalizeUpload)
+func FinalizeUpload(w http.ResponseWriter, r *http.Request) {
+	session, ok := uploadSessionOf(w, r)
+	if !ok {
+		return
+	}
+	finReq := &UploadFinalizeRequest{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(finReq); err != nil && err != io.EOF {
+			writeInvalidParam(w, r, err)
+			return
+		}
+	}
+	tFile, err := model.Uploads.Finalize(session.ID, finReq.FileHash)
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	hash, err := tFile.GetHash()
+	if err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	infoResponse := &FileInfoRespond{
+		Name:       tFile.Name,
+		ParentPath: tFile.ParentPath,
+		Path:       tFile.FilePath,
+		ChunkCount: tFile.GetChunkCount(),
+		FileHash:   hash,
+	}
+	retBytes, err := json.Marshal(infoResponse)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(retBytes)
+}
+
+// Router.Handle("/upload/{uploadid}", AbortUpload)
+func AbortUpload(w http.ResponseWriter, r *http.Request) {
+	session, ok := uploadSessionOf(w, r)
+	if !ok {
+		return
+	}
+	if err := model.Uploads.Abort(session.ID); err != nil {
+		writeModelError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writable tells whether files may be written below path, that is path lies inside a media root
+// and not inside its trash.
+func writable(path string) bool {
+	return model.Library != nil && model.Library.Contains(path) && !model.InTrash(path)
+}
+
+func uploadSessionOf(w http.ResponseWriter, r *http.Request) (*model.UploadSession, bool) {
+	if model.Uploads == nil {
+		writeError(w, r, http.StatusServiceUnavailable, CodeUnavailable, "upload is not available", "")
+		return nil, false
+	}
+	session, err := model.Uploads.Get(mux.Vars(r)["uploadid"])
+	if err != nil {
+		writeModelError(w, r, err)
+		return nil, false
+	}
+	return session, true
+}
+
+func writeUploadSession(w http.ResponseWriter, r *http.Request, status int, session *model.UploadSession) {
+	ret := &UploadSessionRespond{
+		ID:         session.ID,
+		Name:       session.Name,
+		Path:       session.TargetPath(),
+		Size:       session.Size,
+		ChunkSize:  session.ChunkSize,
+		ChunkCount: session.ChunkCount,
+		Missing:    session.MissingChunks(),
+		URL:        fmt.Sprintf("/upload/%s", session.ID),
+	}
+	retBytes, err := json.Marshal(ret)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(retBytes)
+}
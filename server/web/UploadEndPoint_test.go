@@ -0,0 +1,54 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/newm4n/Adverter/server/config"
+	"github.com/newm4n/Adverter/server/web/model"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInitiateUploadLimits(t *testing.T) {
+	root := t.TempDir()
+	model.Library = model.NewMediaIndex(root)
+	defer func() { model.Library = nil }()
+	uploads, err := model.NewUploadManager(t.TempDir(), time.Hour)
+	assert.NoError(t, err)
+	model.Uploads = uploads
+	defer func() { model.Uploads = nil }()
+
+	Router = mux.NewRouter()
+	Router.HandleFunc("/path/{b64path}/upload", InitiateUpload).Methods(http.MethodPost)
+	pi := model.PathInfo{Path: root}
+	initiate := func(size int64, chunkSize int) int {
+		body := fmt.Sprintf(`{"Name":"creative.bin","Size":%d,"ChunkSize":%d}`, size, chunkSize)
+		request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/path/%s/upload", pi.ToPathInfoString()), bytes.NewBufferString(body))
+		response := httptest.NewRecorder()
+		Router.ServeHTTP(response, request)
+		return response.Code
+	}
+	assert.Equal(t, http.StatusCreated, initiate(100000000, 1<<20))
+	// read whole into memory by every chunk upload, so bounded by upload.chunk.max
+	assert.Equal(t, http.StatusBadRequest, initiate(100000000, 1<<30))
+	// a session walks all of its chunks, so tiny chunks are refused
+	assert.Equal(t, http.StatusBadRequest, initiate(100000000, 1))
+
+	// a file in place of the trash of the root is refused
+	request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/path/%s/upload", pi.ToPathInfoString()),
+		bytes.NewBufferString(fmt.Sprintf(`{"Name":%q,"Size":10}`, model.TrashDirName)))
+	response := httptest.NewRecorder()
+	Router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	_, err = os.Stat(filepath.Join(root, model.TrashDirName))
+	assert.True(t, os.IsNotExist(err))
+
+	uploads.MaxSize = int64(config.GetInt("upload.maxsize"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, initiate(1<<40, 1<<20))
+}
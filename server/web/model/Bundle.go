@@ -0,0 +1,211 @@
+package model
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BundleFormat is the archive format of a directory bundle
+type BundleFormat string
+
+const (
+	BundleZip   BundleFormat = "zip"
+	BundleTar   BundleFormat = "tar"
+	BundleTarGz BundleFormat = "tar.gz"
+
+	// BundleManifestName is the name of the last entry of a bundle, listing the hash of every file in it
+	BundleManifestName = "adverter-manifest.json"
+)
+
+// bundleStoredExts are written to ZIP bundles without compression, their format already compresses them
+var bundleStoredExts = map[string]bool{
+	"mp4": true, "m4v": true, "mov": true, "webm": true, "mp3": true, "m4a": true, "aac": true,
+	"jpg": true, "jpeg": true, "png": true, "gif": true, "webp": true, "avif": true,
+	"zip": true, "gz": true, "tgz": true, "7z": true, "rar": true, "woff2": true,
+}
+
+// BundleEntry is a file of a bundle, its path relative to the bundled directory and slash separated
+type BundleEntry struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Hash    string
+}
+
+// BundleManifest lists the files of a bundle
+type BundleManifest struct {
+	Path    string
+	Created time.Time
+	Files   []*BundleEntry
+}
+
+// ParseBundleFormat reads a bundle format name, empty meaning BundleZip
+func ParseBundleFormat(name string) (BundleFormat, error) {
+	switch BundleFormat(strings.ToLower(name)) {
+	case "", BundleZip:
+		return BundleZip, nil
+	case BundleTar:
+		return BundleTar, nil
+	case BundleTarGz, "tgz":
+		return BundleTarGz, nil
+	}
+	return "", fmt.Errorf("unknown bundle format %s", name)
+}
+
+// bundleWriter adds entries to an archive of one format
+type bundleWriter interface {
+	dir(name string, modTime time.Time) error
+	file(name string, size int64, modTime time.Time) (io.Writer, error)
+	Close() error
+}
+
+// WriteBundle streams the whole tree under tDir to w as an archive of the specified format, file by file,
+// ending with a BundleManifestName entry listing the hash of every file. Files are hashed while written,
+// nothing is buffered but the file being copied.
+func WriteBundle(w io.Writer, tDir *TheDirectory, format BundleFormat) (*BundleManifest, error) {
+	var bw bundleWriter
+	switch format {
+	case BundleZip:
+		bw = &zipBundle{zip.NewWriter(w)}
+	case BundleTar:
+		bw = &tarBundle{tw: tar.NewWriter(w)}
+	case BundleTarGz:
+		gz := gzip.NewWriter(w)
+		bw = &tarBundle{tw: tar.NewWriter(gz), gz: gz}
+	default:
+		return nil, fmt.Errorf("unknown bundle format %s", format)
+	}
+	manifest := &BundleManifest{
+		Path:    tDir.DirPath,
+		Created: time.Now(),
+		Files:   make([]*BundleEntry, 0),
+	}
+	if err := bundleDirectory(bw, tDir, "", manifest); err != nil {
+		return manifest, err
+	}
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	out, err := bw.file(BundleManifestName, int64(len(manifestBytes)), manifest.Created)
+	if err != nil {
+		return manifest, err
+	}
+	if _, err := out.Write(manifestBytes); err != nil {
+		return manifest, err
+	}
+	return manifest, bw.Close()
+}
+
+func bundleDirectory(bw bundleWriter, tDir *TheDirectory, prefix string, manifest *BundleManifest) error {
+	files, dirs, err := tDir.ListAll()
+	if err != nil {
+		return err
+	}
+	isFile := make(map[string]bool, len(files))
+	for _, tFile := range files {
+		isFile[tFile.Name] = true
+		name := path.Join(prefix, tFile.Name)
+		hash, err := bundleFile(bw, tFile, name)
+		if err != nil {
+			return fmt.Errorf("can not bundle %s. got %w", tFile.FilePath, err)
+		}
+		manifest.Files = append(manifest.Files, &BundleEntry{
+			Path:    name,
+			Size:    tFile.size,
+			ModTime: tFile.lastUpdate,
+			Hash:    hash,
+		})
+	}
+	for _, sub := range dirs {
+		if isFile[sub.Name] {
+			// a ZIP or TAR file, already bundled as a file
+			continue
+		}
+		name := path.Join(prefix, sub.Name)
+		if err := bw.dir(name, time.Now()); err != nil {
+			return err
+		}
+		if err := bundleDirectory(bw, sub, name, manifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func bundleFile(bw bundleWriter, tFile *TheFile, name string) (string, error) {
+	f, err := tFile.store.Open(tFile.storeName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	out, err := bw.file(name, tFile.size, tFile.lastUpdate)
+	if err != nil {
+		return "", err
+	}
+	h := md5.New()
+	n, err := io.Copy(io.MultiWriter(out, h), f)
+	if err != nil {
+		return "", err
+	}
+	if n != tFile.size {
+		// the archive entry was announced with the size found when listing
+		return "", fmt.Errorf("%s changed while bundled", tFile.FilePath)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type zipBundle struct {
+	zw *zip.Writer
+}
+
+func (zb *zipBundle) dir(name string, modTime time.Time) error {
+	_, err := zb.zw.CreateHeader(&zip.FileHeader{Name: name + "/", Modified: modTime})
+	return err
+}
+
+func (zb *zipBundle) file(name string, size int64, modTime time.Time) (io.Writer, error) {
+	method := zip.Deflate
+	if bundleStoredExts[strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))] {
+		method = zip.Store
+	}
+	return zb.zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: modTime})
+}
+
+func (zb *zipBundle) Close() error {
+	return zb.zw.Close()
+}
+
+type tarBundle struct {
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+func (tb *tarBundle) dir(name string, modTime time.Time) error {
+	return tb.tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: 0755, ModTime: modTime})
+}
+
+func (tb *tarBundle) file(name string, size int64, modTime time.Time) (io.Writer, error) {
+	err := tb.tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: 0644, ModTime: modTime})
+	return tb.tw, err
+}
+
+func (tb *tarBundle) Close() error {
+	if err := tb.tw.Close(); err != nil {
+		return err
+	}
+	if tb.gz != nil {
+		return tb.gz.Close()
+	}
+	return nil
+}
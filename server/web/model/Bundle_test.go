@@ -0,0 +1,87 @@
+package model
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteBundle(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "summer")
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "html5", "img"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "intro.mp4"), []byte("intro"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "html5", "index.html"), []byte("<html></html>"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "html5", "img", "logo.png"), []byte("logo"), 0644))
+	expected := map[string]string{
+		"intro.mp4":          "intro",
+		"html5/index.html":   "<html></html>",
+		"html5/img/logo.png": "logo",
+		BundleManifestName:   "",
+	}
+
+	t.Run("zip", func(t *testing.T) {
+		tDir, err := NewTheDirectory(root)
+		assert.NoError(t, err)
+		buf := &bytes.Buffer{}
+		manifest, err := WriteBundle(buf, tDir, BundleZip)
+		assert.NoError(t, err)
+		assert.Len(t, manifest.Files, 3)
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err)
+		found := make(map[string]string)
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			assert.NoError(t, err)
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			found[f.Name] = string(data)
+		}
+		checkBundle(t, expected, found)
+	})
+
+	t.Run("tar.gz", func(t *testing.T) {
+		tDir, err := NewTheDirectory(root)
+		assert.NoError(t, err)
+		buf := &bytes.Buffer{}
+		_, err = WriteBundle(buf, tDir, BundleTarGz)
+		assert.NoError(t, err)
+
+		gz, err := gzip.NewReader(buf)
+		assert.NoError(t, err)
+		tr := tar.NewReader(gz)
+		found := make(map[string]string)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			if hdr.Typeflag == tar.TypeReg {
+				data, _ := io.ReadAll(tr)
+				found[hdr.Name] = string(data)
+			}
+		}
+		checkBundle(t, expected, found)
+	})
+}
+
+func checkBundle(t *testing.T, expected, found map[string]string) {
+	assert.Len(t, found, len(expected))
+	manifest := &BundleManifest{}
+	assert.NoError(t, json.Unmarshal([]byte(found[BundleManifestName]), manifest))
+	for _, entry := range manifest.Files {
+		assert.Equal(t, expected[entry.Path], found[entry.Path])
+		assert.Equal(t, MD5OfBytes([]byte(expected[entry.Path])), entry.Hash)
+	}
+}
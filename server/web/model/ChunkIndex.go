@@ -0,0 +1,214 @@
+package model
+
+import (
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// Chunks indexes the chunks of every file of the library by hash. It stays nil until the server initialize it.
+	Chunks *ChunkIndex
+
+	// ErrChunkNotFound tells no file of the library holds a chunk
+	ErrChunkNotFound = errors.New("chunk not found")
+)
+
+// ChunkLocation tells where a chunk lies, and the size and modification time of its file when it was indexed
+type ChunkLocation struct {
+	Path     string
+	Offset   int64
+	Size     int
+	FileSize int64
+	ModTime  time.Time
+}
+
+// ChunkIndex maps chunk hashes to the files holding them, so identical content living in several files,
+// or several times in one file, can be served from any of them.
+type ChunkIndex struct {
+	chunking Chunking
+	byHash   map[string][]*ChunkLocation
+	byPath   map[string][]string
+	mutex    sync.RWMutex
+	indexed  atomic.Bool
+}
+
+// NewChunkIndex creates an empty index. Files are cut the chunking way when indexed with IndexFile.
+func NewChunkIndex(chunking Chunking) *ChunkIndex {
+	return &ChunkIndex{
+		chunking: chunking,
+		byHash:   make(map[string][]*ChunkLocation),
+		byPath:   make(map[string][]string),
+	}
+}
+
+// Chunking is the way files are cut by IndexFile
+func (idx *ChunkIndex) Chunking() Chunking {
+	return idx.chunking
+}
+
+// Size returns the number of distinct chunks in the index
+func (idx *ChunkIndex) Size() int {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	return len(idx.byHash)
+}
+
+// Add records the chunks of a manifest of tFile, replacing whatever was known of tFile
+func (idx *ChunkIndex) Add(tFile *TheFile, manifest *ChunkManifest) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	idx.remove(tFile.FilePath)
+	hashes := make([]string, 0, len(manifest.Chunks))
+	seen := make(map[string]bool, len(manifest.Chunks))
+	for _, chunk := range manifest.Chunks {
+		if seen[chunk.Hash] {
+			// one location per file is enough
+			continue
+		}
+		seen[chunk.Hash] = true
+		hashes = append(hashes, chunk.Hash)
+		idx.byHash[chunk.Hash] = append(idx.byHash[chunk.Hash], &ChunkLocation{
+			Path:     tFile.FilePath,
+			Offset:   chunk.Offset,
+			Size:     chunk.Size,
+			FileSize: tFile.size,
+			ModTime:  tFile.lastUpdate,
+		})
+	}
+	idx.byPath[tFile.FilePath] = hashes
+}
+
+// IndexFile cuts the file at path the index's chunking way and records its chunks
+func (idx *ChunkIndex) IndexFile(path string) error {
+	tFile, err := NewTheFile(path)
+	if err != nil {
+		return err
+	}
+	manifest, err := ManifestOf(tFile, idx.chunking)
+	if err != nil {
+		return err
+	}
+	idx.Add(tFile, manifest)
+	return nil
+}
+
+// IndexLibrary records the chunks of every file of lib
+func (idx *ChunkIndex) IndexLibrary(lib *MediaIndex) {
+	files := idx.indexFiles(lib)
+	idx.indexed.Store(true)
+	log.Debugf("chunk index holds %d chunks of %d files", idx.Size(), files)
+}
+
+func (idx *ChunkIndex) indexFiles(lib *MediaIndex) int {
+	entries, _ := lib.Search(&SearchQuery{})
+	for _, entry := range entries {
+		if err := idx.IndexFile(entry.Path); err != nil {
+			log.Warnf("chunk index can not read %s. got %s", entry.Path, err.Error())
+		}
+	}
+	return len(entries)
+}
+
+// Indexed tells whether a whole library was indexed, the index is incomplete until then
+func (idx *ChunkIndex) Indexed() bool {
+	return idx.indexed.Load()
+}
+
+// Remove drops the chunks of path, and of everything below it
+func (idx *ChunkIndex) Remove(path string) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	prefix := path + string(os.PathSeparator)
+	for p := range idx.byPath {
+		if p == path || strings.HasPrefix(p, prefix) {
+			idx.remove(p)
+		}
+	}
+}
+
+func (idx *ChunkIndex) remove(path string) {
+	for _, hash := range idx.byPath[path] {
+		locations := idx.byHash[hash]
+		kept := locations[:0]
+		for _, location := range locations {
+			if location.Path != path {
+				kept = append(kept, location)
+			}
+		}
+		if len(kept) == 0 {
+			delete(idx.byHash, hash)
+		} else {
+			idx.byHash[hash] = kept
+		}
+	}
+	delete(idx.byPath, path)
+}
+
+// Locate lists the known locations of a chunk
+func (idx *ChunkIndex) Locate(hash string) []*ChunkLocation {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	return append([]*ChunkLocation{}, idx.byHash[hash]...)
+}
+
+// Read returns the bytes of the chunk with the specified hash from the first of its files still holding it.
+// Files changed since they were indexed are dropped from the index.
+func (idx *ChunkIndex) Read(hash string) ([]byte, error) {
+	for _, location := range idx.Locate(hash) {
+		tFile, err := NewTheFile(location.Path)
+		if err != nil || tFile.size != location.FileSize || !tFile.lastUpdate.Equal(location.ModTime) {
+			idx.Remove(location.Path)
+			continue
+		}
+		byts, chunkHash, err := tFile.GetBytes(int(location.Offset), int(location.Offset)+location.Size)
+		if err != nil {
+			log.Warnf("chunk index can not read %s. got %s", location.Path, err.Error())
+			continue
+		}
+		if chunkHash != hash {
+			idx.Remove(location.Path)
+			continue
+		}
+		cacheLookup("chunk_index", true)
+		return byts, nil
+	}
+	cacheLookup("chunk_index", false)
+	return nil, ErrChunkNotFound
+}
+
+// OnChange keeps the index current with a change made through the API. It is meant to be
+// registered with SubscribeChanges. Changed files are hashed again in the background.
+func (idx *ChunkIndex) OnChange(event *ChangeEvent) {
+	switch event.Op {
+	case ChangeRemoved:
+		idx.Remove(event.Path)
+	case ChangeMoved:
+		idx.Remove(event.OldPath)
+		go idx.reindex(event.Path)
+	default:
+		idx.Remove(event.Path)
+		go idx.reindex(event.Path)
+	}
+}
+
+func (idx *ChunkIndex) reindex(path string) {
+	inf, err := StatPath(path)
+	if err != nil {
+		return
+	}
+	if inf.IsDir() {
+		lib := NewMediaIndex(path)
+		if err := lib.Scan(); err == nil {
+			idx.indexFiles(lib)
+		}
+		return
+	}
+	if err := idx.IndexFile(path); err != nil {
+		log.Warnf("chunk index can not read %s. got %s", path, err.Error())
+	}
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChunkIndex(t *testing.T) {
+	root := t.TempDir()
+	intro := make([]byte, 300*1024)
+	rand.New(rand.NewSource(3)).Read(intro)
+	spotA := append(append([]byte{}, intro...), []byte("spot a")...)
+	spotB := append(append([]byte{}, intro...), []byte("spot b, a little longer")...)
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "a.mp4"), spotA, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "b.mp4"), spotB, 0644))
+
+	lib := NewMediaIndex(root)
+	assert.NoError(t, lib.Scan())
+	idx := NewChunkIndex(ChunkingCDC)
+	idx.IndexLibrary(lib)
+
+	tFile, err := NewTheFile(filepath.Join(root, "a.mp4"))
+	assert.NoError(t, err)
+	manifest, err := ManifestOf(tFile, ChunkingCDC)
+	assert.NoError(t, err)
+	first := manifest.Chunks[0]
+	assert.Len(t, idx.Locate(first.Hash), 2)
+
+	byts, err := idx.Read(first.Hash)
+	assert.NoError(t, err)
+	assert.Equal(t, spotA[:first.Size], byts)
+
+	// a changed file is dropped, the other one still serves the chunk
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "a.mp4"), []byte("replaced"), 0644))
+	byts, err = idx.Read(first.Hash)
+	assert.NoError(t, err)
+	assert.Equal(t, spotB[:first.Size], byts)
+	assert.Len(t, idx.Locate(first.Hash), 1)
+
+	idx.Remove(root)
+	_, err = idx.Read(first.Hash)
+	assert.ErrorIs(t, err, ErrChunkNotFound)
+	assert.Equal(t, 0, idx.Size())
+}
@@ -0,0 +1,235 @@
+package model
+
+import (
+	"container/list"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ChunkEntry describes one chunk of a file
+type ChunkEntry struct {
+	Index  int
+	Offset int64
+	Size   int
+	Hash   string
+	// Weak is the rolling checksum of the chunk, see Rolling
+	Weak uint32
+}
+
+// ChunkManifest lists the chunks of a file along with their hashes
+type ChunkManifest struct {
+	Chunking Chunking
+	Size     int64
+	// ChunkSize is the size of every chunk but the last with ChunkingFixed, 0 with ChunkingCDC
+	ChunkSize int
+	FileHash  string
+	Chunks    []*ChunkEntry
+}
+
+type manifestKey struct {
+	path      string
+	size      int64
+	modTime   time.Time
+	chunkSize int
+	chunking  Chunking
+}
+
+// DefaultManifestCacheSize is how many manifests are cached unless SetManifestCacheSize says otherwise
+const DefaultManifestCacheSize = 1024
+
+// manifestCache keeps the most recently used manifests, dropping the least recently used one when full
+type manifestCache struct {
+	mutex   sync.Mutex
+	max     int
+	order   *list.List
+	entries map[manifestKey]*list.Element
+}
+
+type manifestCacheEntry struct {
+	key      manifestKey
+	manifest *ChunkManifest
+}
+
+var manifests = newManifestCache(DefaultManifestCacheSize)
+
+func newManifestCache(max int) *manifestCache {
+	return &manifestCache{max: max, order: list.New(), entries: make(map[manifestKey]*list.Element)}
+}
+
+func (cache *manifestCache) load(key manifestKey) (*ChunkManifest, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	elem, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+	cache.order.MoveToFront(elem)
+	return elem.Value.(*manifestCacheEntry).manifest, true
+}
+
+func (cache *manifestCache) store(key manifestKey, manifest *ChunkManifest) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if elem, ok := cache.entries[key]; ok {
+		elem.Value.(*manifestCacheEntry).manifest = manifest
+		cache.order.MoveToFront(elem)
+		return
+	}
+	cache.entries[key] = cache.order.PushFront(&manifestCacheEntry{key: key, manifest: manifest})
+	cache.trim()
+}
+
+// trim drops the least recently used manifests above max. The mutex must be held.
+func (cache *manifestCache) trim() {
+	for cache.order.Len() > cache.max {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*manifestCacheEntry).key)
+	}
+}
+
+// evict drops the manifests whose key matches
+func (cache *manifestCache) evict(match func(key manifestKey) bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for key, elem := range cache.entries {
+		if match(key) {
+			cache.order.Remove(elem)
+			delete(cache.entries, key)
+		}
+	}
+}
+
+// SetManifestCacheSize bounds how many manifests are cached, dropping the least recently used ones above max
+func SetManifestCacheSize(max int) {
+	manifests.mutex.Lock()
+	defer manifests.mutex.Unlock()
+	manifests.max = max
+	manifests.trim()
+}
+
+// EvictManifests drops the cached manifests of path, and of every file below it
+func EvictManifests(path string) {
+	manifests.evict(func(key manifestKey) bool {
+		return isBelow(key.path, path)
+	})
+}
+
+// OnManifestChange evicts the manifests of the files changed through the API, it is meant to be subscribed
+// with SubscribeChanges
+func OnManifestChange(event *ChangeEvent) {
+	EvictManifests(event.Path)
+	if len(event.OldPath) > 0 {
+		EvictManifests(event.OldPath)
+	}
+}
+
+// ManifestOf hashes every chunk of tFile, cut the chunking way, and the whole file in a single pass.
+// Manifests are kept until the file changes. Manifests cut the Chunks way feed the chunk index.
+func ManifestOf(tFile *TheFile, chunking Chunking) (*ChunkManifest, error) {
+	key := manifestKey{path: tFile.FilePath, size: tFile.size, modTime: tFile.lastUpdate, chunkSize: tFile.chunkSize, chunking: chunking}
+	if cached, ok := manifests.load(key); ok {
+		cacheLookup("manifest", true)
+		return cached, nil
+	}
+	cacheLookup("manifest", false)
+	defer observeSince(hashDuration, time.Now(), "manifest")
+	f, err := tFile.store.Open(tFile.storeName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	manifest := &ChunkManifest{
+		Chunking: chunking,
+		Size:     tFile.size,
+		Chunks:   make([]*ChunkEntry, 0),
+	}
+	fileHash := md5.New()
+	offset := int64(0)
+	emit := func(chunk []byte) {
+		fileHash.Write(chunk)
+		manifest.Chunks = append(manifest.Chunks, &ChunkEntry{
+			Index:  len(manifest.Chunks),
+			Offset: offset,
+			Size:   len(chunk),
+			Hash:   MD5OfBytes(chunk),
+			Weak:   WeakChecksum(chunk),
+		})
+		offset += int64(len(chunk))
+	}
+	if chunking == ChunkingCDC {
+		err = ChunkContent(f, emit)
+	} else {
+		manifest.ChunkSize = tFile.chunkSize
+		err = chunkFixed(f, tFile.chunkSize, emit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	manifest.FileHash = hex.EncodeToString(fileHash.Sum(nil))
+	manifests.store(key, manifest)
+	if Chunks != nil && Chunks.chunking == chunking {
+		Chunks.Add(tFile, manifest)
+	}
+	return manifest, nil
+}
+
+func chunkFixed(r io.Reader, chunkSize int, emit func(chunk []byte)) error {
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			emit(buf[:n])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ChangedChunks lists the indexes of the chunks of manifest the holder of hashes lacks.
+// With ChunkingFixed a chunk must be at the same index of hashes, with ChunkingCDC anywhere in it.
+func (manifest *ChunkManifest) ChangedChunks(hashes []string) []int {
+	held := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		held[hash] = true
+	}
+	changed := make([]int, 0)
+	for _, chunk := range manifest.Chunks {
+		if manifest.Chunking == ChunkingCDC {
+			if !held[chunk.Hash] {
+				changed = append(changed, chunk.Index)
+			}
+		} else if chunk.Index >= len(hashes) || hashes[chunk.Index] != chunk.Hash {
+			changed = append(changed, chunk.Index)
+		}
+	}
+	return changed
+}
+
+// Chunk finds a chunk by its index, when id is a number, or by its hash
+func (manifest *ChunkManifest) Chunk(id string) (*ChunkEntry, bool) {
+	for _, chunk := range manifest.Chunks {
+		if chunk.Hash == id {
+			return chunk, true
+		}
+	}
+	index, err := strconv.Atoi(id)
+	if err != nil || index < 0 || index >= len(manifest.Chunks) {
+		return nil, false
+	}
+	return manifest.Chunks[index], true
+}
+
+// ChunkBytes reads the bytes of a chunk of the manifest of tFile, returning them along with their hash
+func (tFile *TheFile) ChunkBytes(chunk *ChunkEntry) (chunkBytes []byte, chunkHash string, err error) {
+	return tFile.GetBytes(int(chunk.Offset), int(chunk.Offset)+chunk.Size)
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestOf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "intro.mp4")
+	content := make([]byte, 2*DefaultChunkSize+10)
+	content[DefaultChunkSize] = 1
+	assert.NoError(t, os.WriteFile(path, content, 0644))
+
+	tFile, err := NewTheFile(path)
+	assert.NoError(t, err)
+	manifest, err := ManifestOf(tFile, ChunkingFixed)
+	assert.NoError(t, err)
+	assert.Len(t, manifest.Chunks, 3)
+	assert.Equal(t, int64(2*DefaultChunkSize), manifest.Chunks[2].Offset)
+	assert.Equal(t, 10, manifest.Chunks[2].Size)
+	assert.NotEqual(t, manifest.Chunks[0].Hash, manifest.Chunks[1].Hash)
+
+	hash, err := tFile.GetHash()
+	assert.NoError(t, err)
+	assert.Equal(t, hash, manifest.FileHash)
+	_, chunkHash, err := tFile.GetByteOfChunk(1)
+	assert.NoError(t, err)
+	assert.Equal(t, chunkHash, manifest.Chunks[1].Hash)
+}
+
+func TestManifestEvictedOnChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "campaign", "intro.mp4")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, make([]byte, 1000), 0644))
+	cached := func() bool {
+		manifests.mutex.Lock()
+		defer manifests.mutex.Unlock()
+		for key := range manifests.entries {
+			if key.path == path {
+				return true
+			}
+		}
+		return false
+	}
+
+	tFile, err := NewTheFile(path)
+	assert.NoError(t, err)
+	_, err = ManifestOf(tFile, ChunkingFixed)
+	assert.NoError(t, err)
+	assert.True(t, cached())
+
+	// moving the parent directory evicts the manifests of the files below it
+	OnManifestChange(&ChangeEvent{Op: ChangeMoved, Path: filepath.Join(dir, "moved"), OldPath: filepath.Dir(path), IsDir: true})
+	assert.False(t, cached())
+}
+
+func TestManifestCacheBounded(t *testing.T) {
+	SetManifestCacheSize(2)
+	defer SetManifestCacheSize(DefaultManifestCacheSize)
+	dir := t.TempDir()
+	files := make([]*TheFile, 3)
+	for i := range files {
+		path := filepath.Join(dir, fmt.Sprintf("intro-%d.mp4", i))
+		assert.NoError(t, os.WriteFile(path, make([]byte, 1000), 0644))
+		tFile, err := NewTheFile(path)
+		assert.NoError(t, err)
+		files[i] = tFile
+	}
+
+	first, err := ManifestOf(files[0], ChunkingFixed)
+	assert.NoError(t, err)
+	_, err = ManifestOf(files[1], ChunkingFixed)
+	assert.NoError(t, err)
+	// using the first makes the second the least recently used, dropped by the third
+	again, err := ManifestOf(files[0], ChunkingFixed)
+	assert.NoError(t, err)
+	assert.Same(t, first, again)
+	_, err = ManifestOf(files[2], ChunkingFixed)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, manifests.order.Len())
+	assert.Len(t, manifests.entries, 2)
+	for key := range manifests.entries {
+		assert.NotEqual(t, files[1].FilePath, key.path)
+	}
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// Chunking is the way a file is cut into chunks
+type Chunking string
+
+const (
+	// ChunkingFixed cuts a file every chunk size bytes
+	ChunkingFixed Chunking = "fixed"
+	// ChunkingCDC cuts a file where its content says so (FastCDC), so an insertion only changes
+	// the chunks around it and identical content gives identical chunks in any file
+	ChunkingCDC Chunking = "cdc"
+
+	CDCMinSize = 16 * 1024
+	CDCAvgSize = 64 * 1024
+	CDCMaxSize = 256 * 1024
+)
+
+var (
+	gear [256]uint64
+
+	// harder to match below the average size, easier above, so chunk sizes gather around the average
+	cdcMaskSmall = ^uint64(0) << (64 - (bits.Len(CDCAvgSize) - 1 + 2))
+	cdcMaskLarge = ^uint64(0) << (64 - (bits.Len(CDCAvgSize) - 1 - 2))
+)
+
+func init() {
+	// the gear table must never change, chunk boundaries and hashes depend on it
+	seed := uint64(0x41647665727465)
+	for i := range gear {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// ParseChunking reads a chunking name, empty meaning ChunkingFixed
+func ParseChunking(name string) (Chunking, error) {
+	switch Chunking(name) {
+	case "", ChunkingFixed:
+		return ChunkingFixed, nil
+	case ChunkingCDC:
+		return ChunkingCDC, nil
+	}
+	return "", fmt.Errorf("unknown chunking %s", name)
+}
+
+// cdcCut returns the length of the first chunk of data
+func cdcCut(data []byte) int {
+	n := len(data)
+	if n <= CDCMinSize {
+		return n
+	}
+	if n > CDCMaxSize {
+		n = CDCMaxSize
+	}
+	normal := CDCAvgSize
+	if n < normal {
+		normal = n
+	}
+	fp := uint64(0)
+	i := CDCMinSize
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&cdcMaskSmall == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&cdcMaskLarge == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// ChunkContent cuts everything read from r into content defined chunks, calling emit with each of them.
+// The chunk is only valid during the call.
+func ChunkContent(r io.Reader, emit func(chunk []byte)) error {
+	buf := make([]byte, 2*CDCMaxSize)
+	filled := 0
+	eof := false
+	for {
+		for !eof && filled < CDCMaxSize {
+			n, err := r.Read(buf[filled:])
+			filled += n
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		if filled == 0 {
+			return nil
+		}
+		cut := cdcCut(buf[:filled])
+		emit(buf[:cut])
+		filled = copy(buf, buf[cut:filled])
+	}
+}
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func chunkHashes(t *testing.T, content []byte) []string {
+	hashes := make([]string, 0)
+	total := 0
+	assert.NoError(t, ChunkContent(bytes.NewReader(content), func(chunk []byte) {
+		assert.LessOrEqual(t, len(chunk), CDCMaxSize)
+		total += len(chunk)
+		hashes = append(hashes, MD5OfBytes(chunk))
+	}))
+	assert.Equal(t, len(content), total)
+	return hashes
+}
+
+func TestChunkContent(t *testing.T) {
+	content := make([]byte, 2*1024*1024)
+	rand.New(rand.NewSource(1)).Read(content)
+	before := chunkHashes(t, content)
+	assert.Greater(t, len(before), 8)
+
+	inserted := append(append(append([]byte{}, content[:1000000]...), []byte("some inserted bytes")...), content[1000000:]...)
+	after := chunkHashes(t, inserted)
+
+	held := make(map[string]bool)
+	for _, hash := range before {
+		held[hash] = true
+	}
+	shared := 0
+	for _, hash := range after {
+		if held[hash] {
+			shared++
+		}
+	}
+	// only the chunks around the insertion change
+	assert.GreaterOrEqual(t, shared, len(after)-2)
+}
+
+func TestCDCManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "intro.mp4")
+	content := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(2)).Read(content)
+	assert.NoError(t, os.WriteFile(path, content, 0644))
+
+	tFile, err := NewTheFile(path)
+	assert.NoError(t, err)
+	manifest, err := ManifestOf(tFile, ChunkingCDC)
+	assert.NoError(t, err)
+	assert.Equal(t, ChunkingCDC, manifest.Chunking)
+	assert.Equal(t, 0, manifest.ChunkSize)
+	hash, err := tFile.GetHash()
+	assert.NoError(t, err)
+	assert.Equal(t, hash, manifest.FileHash)
+
+	last := manifest.Chunks[len(manifest.Chunks)-1]
+	chunk, ok := manifest.Chunk(last.Hash)
+	assert.True(t, ok)
+	byts, chunkHash, err := tFile.ChunkBytes(chunk)
+	assert.NoError(t, err)
+	assert.Equal(t, last.Hash, chunkHash)
+	assert.Equal(t, content[last.Offset:], byts)
+
+	assert.Equal(t, []int{last.Index}, manifest.ChangedChunks(hashesBut(manifest, last.Index)))
+}
+
+func hashesBut(manifest *ChunkManifest, index int) []string {
+	hashes := make([]string, 0)
+	for _, chunk := range manifest.Chunks {
+		if chunk.Index != index {
+			hashes = append(hashes, chunk.Hash)
+		}
+	}
+	return hashes
+}
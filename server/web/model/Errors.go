@@ -0,0 +1,56 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+)
+
+var (
+	// ErrNotFound tells a media path does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrDenied tells a media path may not be read or written
+	ErrDenied = errors.New("permission denied")
+	// ErrChunkOutOfRange tells a file has no chunk of the requested index or hash
+	ErrChunkOutOfRange = errors.New("chunk out of range")
+	// ErrRangeOutOfBounds tells a byte range does not lie within a file
+	ErrRangeOutOfBounds = errors.New("byte range out of bounds")
+	// ErrExist tells a media path is already taken
+	ErrExist = errors.New("already exist")
+	// ErrTooLarge tells a request is above a configured size limit
+	ErrTooLarge = errors.New("too large")
+	// ErrInvalid tells a request can not be served as asked, eg. an invalid name or a hash mismatch
+	ErrInvalid = errors.New("invalid")
+)
+
+// PathError records the failure of an operation on a media path. Kind is one of the errors above,
+// so both errors.Is(err, Kind) and errors.Is on the cause hold.
+type PathError struct {
+	Path string
+	Kind error
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err.Error())
+}
+
+func (e *PathError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// pathErrorOf classifies the failure of a storage on path p, returning err as is when it is of no known kind
+func pathErrorOf(p string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, syscall.ENOTDIR):
+		return &PathError{Path: p, Kind: ErrNotFound, Err: err}
+	case errors.Is(err, fs.ErrPermission):
+		return &PathError{Path: p, Kind: ErrDenied, Err: err}
+	case errors.Is(err, fs.ErrExist):
+		return &PathError{Path: p, Kind: ErrExist, Err: err}
+	}
+	return err
+}
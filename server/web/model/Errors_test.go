@@ -0,0 +1,23 @@
+package model
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathErrorKinds(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	_, err := NewTheFile(missing)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	assert.False(t, errors.Is(err, ErrDenied))
+
+	_, err = NewTheDirectory(missing)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	_, err = NewTheFile(t.TempDir())
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
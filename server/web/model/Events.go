@@ -0,0 +1,55 @@
+package model
+
+import (
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+type ChangeOp string
+
+const (
+	ChangeCreated  ChangeOp = "created"
+	ChangeModified ChangeOp = "modified"
+	ChangeRemoved  ChangeOp = "removed"
+	ChangeMoved    ChangeOp = "moved"
+)
+
+// ChangeEvent tells that a file or directory of the media library was changed through the API.
+// OldPath is only set when the path was moved or renamed.
+type ChangeEvent struct {
+	Op      ChangeOp
+	Path    string
+	OldPath string
+	IsDir   bool
+	Time    time.Time
+}
+
+var (
+	changeSubscribers = make([]func(event *ChangeEvent), 0)
+	changeMutex       sync.RWMutex
+)
+
+// SubscribeChanges registers fn to be called, synchronously, on every published change
+func SubscribeChanges(fn func(event *ChangeEvent)) {
+	changeMutex.Lock()
+	defer changeMutex.Unlock()
+	changeSubscribers = append(changeSubscribers, fn)
+}
+
+// PublishChange notifies every subscriber of a change
+func PublishChange(op ChangeOp, path, oldPath string, isDir bool) {
+	event := &ChangeEvent{
+		Op:      op,
+		Path:    path,
+		OldPath: oldPath,
+		IsDir:   isDir,
+		Time:    time.Now(),
+	}
+	log.Infof("media %s %s %s", op, oldPath, path)
+	changeMutex.RLock()
+	defer changeMutex.RUnlock()
+	for _, fn := range changeSubscribers {
+		fn(event)
+	}
+}
@@ -0,0 +1,145 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// MakeDirectory creates the directory name inside tDir
+func MakeDirectory(tDir *TheDirectory, name string) (*TheDirectory, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(tDir.DirPath, name)
+	if err := checkNotTrash(path); err != nil {
+		return nil, err
+	}
+	if err := mkdirPath(path, 0755); err != nil {
+		return nil, err
+	}
+	PublishChange(ChangeCreated, path, "", true)
+	return NewTheDirectory(path)
+}
+
+// RenamePath gives the file or directory at path a new name within the same parent directory
+func RenamePath(path, newName string, overwrite bool) (string, error) {
+	return MovePath(path, filepath.Dir(path), newName, overwrite)
+}
+
+// MovePath moves the file or directory at path into the directory dstDir under newName.
+// An empty newName keeps the current name. An existing file is only replaced when overwrite is set,
+// an existing directory is never replaced.
+func MovePath(path, dstDir, newName string, overwrite bool) (string, error) {
+	if len(newName) == 0 {
+		newName = filepath.Base(path)
+	}
+	if err := ValidateName(newName); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dstDir, newName)
+	if err := checkNotTrash(path, dst); err != nil {
+		return "", err
+	}
+	inf, err := StatPath(path)
+	if err != nil {
+		return "", err
+	}
+	if dst == filepath.Clean(path) {
+		return dst, nil
+	}
+	if inf.IsDir() && isBelow(dst, path) {
+		return "", fmt.Errorf("can not move %s into itself. got %w", path, ErrInvalid)
+	}
+	if err := checkDestination(dst, overwrite); err != nil {
+		return "", err
+	}
+	if err := renamePath(path, dst); err != nil {
+		return "", err
+	}
+	PublishChange(ChangeMoved, dst, path, inf.IsDir())
+	return dst, nil
+}
+
+// CopyPath copies the file at path into the directory dstDir under newName.
+// An empty newName keeps the current name.
+func CopyPath(path, dstDir, newName string, overwrite bool) (string, error) {
+	if len(newName) == 0 {
+		newName = filepath.Base(path)
+	}
+	if err := ValidateName(newName); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dstDir, newName)
+	if err := checkNotTrash(dst); err != nil {
+		return "", err
+	}
+	inf, err := StatPath(path)
+	if err != nil {
+		return "", err
+	}
+	if inf.IsDir() {
+		return "", fmt.Errorf("%s is not a file. got %w", path, ErrInvalid)
+	}
+	if dst == filepath.Clean(path) {
+		return "", fmt.Errorf("can not copy %s onto itself. got %w", path, ErrInvalid)
+	}
+	if err := checkDestination(dst, overwrite); err != nil {
+		return "", err
+	}
+	if err := copyFilePath(path, dst); err != nil {
+		return "", err
+	}
+	PublishChange(ChangeCreated, dst, "", false)
+	return dst, nil
+}
+
+// DeletePath permanently removes the file or directory at path, including everything below it
+func DeletePath(path string) error {
+	if err := checkNotTrash(path); err != nil {
+		return err
+	}
+	inf, err := StatPath(path)
+	if err != nil {
+		return err
+	}
+	if err := removeAllPath(path); err != nil {
+		return err
+	}
+	PublishChange(ChangeRemoved, path, "", inf.IsDir())
+	return nil
+}
+
+// checkNotTrash refuses paths that are a trash directory, or lie inside one, which only the trash
+// functions may change
+func checkNotTrash(paths ...string) error {
+	for _, path := range paths {
+		if InTrash(path) {
+			return &PathError{Path: path, Kind: ErrDenied, Err: fmt.Errorf("the trash can not be changed this way")}
+		}
+	}
+	return nil
+}
+
+func checkDestination(dst string, overwrite bool) error {
+	inf, err := StatPath(dst)
+	if err != nil {
+		return nil
+	}
+	if inf.IsDir() || !overwrite {
+		return fmt.Errorf("%s already exist. got %w", dst, ErrExist)
+	}
+	return nil
+}
+
+func isBelow(path, parent string) bool {
+	rel, err := filepath.Rel(parent, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !filepath.IsAbs(rel) && !startsWithParent(rel))
+}
+
+func startsWithParent(rel string) bool {
+	return len(rel) >= 3 && rel[:2] == ".." && os.IsPathSeparator(rel[2])
+}
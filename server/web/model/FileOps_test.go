@@ -0,0 +1,110 @@
+package model
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileOperations(t *testing.T) {
+	root := t.TempDir()
+	events := make([]*ChangeEvent, 0)
+	SubscribeChanges(func(event *ChangeEvent) {
+		events = append(events, event)
+	})
+	tRoot, err := NewTheDirectory(root)
+	assert.NoError(t, err)
+
+	campaign, err := MakeDirectory(tRoot, "campaign")
+	assert.NoError(t, err)
+	_, err = MakeDirectory(tRoot, "..")
+	assert.Error(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "ad.mp4"), []byte("video"), 0644))
+
+	copied, err := CopyPath(filepath.Join(root, "ad.mp4"), campaign.DirPath, "", false)
+	assert.NoError(t, err)
+	_, err = CopyPath(filepath.Join(root, "ad.mp4"), campaign.DirPath, "", false)
+	assert.Error(t, err)
+	data, err := os.ReadFile(copied)
+	assert.NoError(t, err)
+	assert.Equal(t, "video", string(data))
+
+	renamed, err := RenamePath(copied, "promo.mp4", false)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(campaign.DirPath, "promo.mp4"), renamed)
+
+	_, err = MovePath(campaign.DirPath, campaign.DirPath, "", false)
+	assert.Error(t, err)
+	moved, err := MovePath(filepath.Join(root, "ad.mp4"), campaign.DirPath, "", false)
+	assert.NoError(t, err)
+	_, err = os.Stat(moved)
+	assert.NoError(t, err)
+
+	item, err := TrashPath(root, campaign.DirPath)
+	assert.NoError(t, err)
+	assert.True(t, item.IsDir)
+	_, err = os.Stat(campaign.DirPath)
+	assert.True(t, os.IsNotExist(err))
+	assert.True(t, InTrash(item.contentPath()))
+
+	dirs, err := tRoot.ListDirectories()
+	assert.NoError(t, err)
+	assert.Len(t, dirs, 0)
+
+	restored, err := GetTrashItem(root, item.ID)
+	assert.NoError(t, err)
+	assert.NoError(t, restored.Restore())
+	_, err = os.Stat(filepath.Join(campaign.DirPath, "promo.mp4"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, DeletePath(campaign.DirPath))
+	_, err = os.Stat(campaign.DirPath)
+	assert.True(t, os.IsNotExist(err))
+
+	ops := make([]ChangeOp, 0, len(events))
+	for _, e := range events {
+		ops = append(ops, e.Op)
+	}
+	assert.Equal(t, []ChangeOp{ChangeCreated, ChangeCreated, ChangeMoved, ChangeMoved, ChangeRemoved, ChangeCreated, ChangeRemoved}, ops)
+}
+
+func TestTrashProtected(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "ad.mp4"), []byte("video"), 0644))
+	item, err := TrashPath(root, filepath.Join(root, "ad.mp4"))
+	assert.NoError(t, err)
+	trash := filepath.Join(root, TrashDirName)
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "campaign"), 0755))
+
+	err = DeletePath(trash)
+	assert.True(t, errors.Is(err, ErrDenied))
+	_, err = MovePath(trash, filepath.Join(root, "campaign"), "", false)
+	assert.True(t, errors.Is(err, ErrDenied))
+	_, err = RenamePath(filepath.Join(root, "campaign"), TrashDirName, false)
+	assert.True(t, errors.Is(err, ErrDenied))
+	_, err = CopyPath(filepath.Join(root, "campaign"), trash, "ad.mp4", false)
+	assert.True(t, errors.Is(err, ErrDenied))
+	_, err = TrashPath(root, trash)
+	assert.True(t, errors.Is(err, ErrDenied))
+
+	// nothing may be created at or in the trash either
+	tRoot, err := NewTheDirectory(root)
+	assert.NoError(t, err)
+	_, err = MakeDirectory(tRoot, TrashDirName)
+	assert.True(t, errors.Is(err, ErrDenied))
+	uploads, err := NewUploadManager(t.TempDir(), time.Hour)
+	assert.NoError(t, err)
+	_, err = uploads.Initiate(tRoot, TrashDirName, 10, 0, "", true)
+	assert.True(t, errors.Is(err, ErrDenied))
+	tusUploads, err := NewTusManager(t.TempDir(), time.Hour)
+	assert.NoError(t, err)
+	_, err = tusUploads.Create(tRoot, TrashDirName, 10, nil)
+	assert.True(t, errors.Is(err, ErrDenied))
+
+	assert.NoError(t, item.Restore())
+	_, err = os.Stat(filepath.Join(root, "ad.mp4"))
+	assert.NoError(t, err)
+}
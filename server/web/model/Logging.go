@@ -0,0 +1,31 @@
+package model
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+)
+
+// requestIDKey is the context key of the ID of the request being served
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the ID of the request being served
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDOf returns the ID of the request carried by ctx, empty when there is none
+func RequestIDOf(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// Logger returns the logrus entry to log with while serving the request of ctx, tagged with its ID
+func Logger(ctx context.Context) *log.Entry {
+	if requestID := RequestIDOf(ctx); len(requestID) > 0 {
+		return log.WithField("requestId", requestID)
+	}
+	return log.NewEntry(log.StandardLogger())
+}
@@ -1,11 +1,16 @@
 package model
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"github.com/newm4n/Adverter/server/storage"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/fs"
 	"os"
 	"strings"
 	"time"
@@ -20,26 +25,27 @@ type TheFile struct {
 	Name       string
 	FilePath   string
 	content    []byte
+	size       int64
+	store      storage.Storage
+	storeName  string
 	chunkSize  int
 	lastUpdate time.Time
+	logger     *log.Entry
 }
 
+// NewTheFile looks up the file at filePath. Its content is only read when asked for,
+// chunks are read straight from the storage holding the file.
 func NewTheFile(filePath string) (*TheFile, error) {
-	f, err := os.OpenFile(filePath, os.O_RDONLY, os.ModeType)
+	store, storeName, err := Resolve(filePath)
 	if err != nil {
-		return nil, err
+		return nil, pathErrorOf(filePath, err)
 	}
-	inf, err := os.Stat(filePath)
+	inf, err := store.Stat(storeName)
 	if err != nil {
-		return nil, err
+		return nil, pathErrorOf(filePath, err)
 	}
 	if inf.IsDir() {
-		return nil, fmt.Errorf("%s is not a file", filePath)
-	}
-	data := make([]byte, inf.Size())
-	totRead, err := f.Read(data)
-	if totRead != int(inf.Size()) {
-		return nil, fmt.Errorf("read size is not equal to actual size read %d != actual %d", totRead, inf.Size())
+		return nil, &PathError{Path: filePath, Kind: ErrNotFound, Err: fmt.Errorf("not a file")}
 	}
 
 	lIdx := strings.LastIndex(filePath, string(os.PathSeparator))
@@ -48,35 +54,84 @@ func NewTheFile(filePath string) (*TheFile, error) {
 		ParentPath: filePath[:lIdx],
 		Name:       filePath[lIdx+1:],
 		FilePath:   filePath,
-		content:    data,
+		size:       inf.Size(),
+		store:      store,
+		storeName:  storeName,
 		chunkSize:  DefaultChunkSize,
+		lastUpdate: inf.ModTime(),
 	}, nil
 }
 
 func (tFile *TheFile) GetContent() []byte {
+	if tFile.content == nil {
+		data, err := fs.ReadFile(tFile.store, tFile.storeName)
+		if err != nil {
+			tFile.log().Errorf("can not read %s. got %s", tFile.FilePath, err.Error())
+			return nil
+		}
+		tFile.content = data
+	}
 	return tFile.content
 }
 
+// WithContext makes tFile log with the request ID carried by ctx
+func (tFile *TheFile) WithContext(ctx context.Context) *TheFile {
+	tFile.logger = Logger(ctx)
+	return tFile
+}
+
+func (tFile *TheFile) log() *log.Entry {
+	if tFile.logger == nil {
+		return log.NewEntry(log.StandardLogger())
+	}
+	return tFile.logger
+}
+
+// GetSize returns the size of the file in bytes
+func (tFile *TheFile) GetSize() int64 {
+	return tFile.size
+}
+
 func (tFile *TheFile) GetChunkCount() int {
-	if len(tFile.GetContent())%tFile.chunkSize == 0 {
-		return len(tFile.GetContent()) / tFile.chunkSize
+	if tFile.size%int64(tFile.chunkSize) == 0 {
+		return int(tFile.size / int64(tFile.chunkSize))
 	}
-	return (len(tFile.GetContent()) / tFile.chunkSize) + 1
+	return int(tFile.size/int64(tFile.chunkSize)) + 1
 }
 
 func (tFile *TheFile) GetHash() (contentHash string, err error) {
-	if len(tFile.GetContent()) <= 0 {
-		return "", fmt.Errorf("can not hash empty file")
-	}
+	defer observeSince(hashDuration, time.Now(), "file")
 	h := md5.New()
-	h.Write(tFile.GetContent())
+	if tFile.content != nil {
+		h.Write(tFile.content)
+	} else {
+		f, err := tFile.store.Open(tFile.storeName)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	}
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
+// GetBytes reads the bytes from byteFrom up to byteTo, returning them along with their hash.
+// An empty range, or one outside of the file, fails with ErrRangeOutOfBounds.
 func (tFile *TheFile) GetBytes(byteFrom, byteTo int) (fromToBytes []byte, fromToHash string, err error) {
-	fromToBytes = tFile.GetContent()[byteFrom:byteTo]
+	if byteFrom < 0 || byteTo <= byteFrom || int64(byteTo) > tFile.size {
+		return nil, "", &PathError{Path: tFile.FilePath, Kind: ErrRangeOutOfBounds,
+			Err: fmt.Errorf("no bytes %d to %d, the file has %d bytes", byteFrom, byteTo, tFile.size)}
+	}
+	fromToBytes, err = tFile.readRange(int64(byteFrom), int64(byteTo))
+	if err != nil {
+		return nil, "", err
+	}
 	if len(fromToBytes) <= 0 {
-		return nil, "", fmt.Errorf("can not hash empty slice")
+		// the file shrank since it was opened
+		return nil, "", &PathError{Path: tFile.FilePath, Kind: ErrRangeOutOfBounds,
+			Err: fmt.Errorf("no bytes %d to %d, the file is shorter", byteFrom, byteTo)}
 	}
 
 	h := md5.New()
@@ -85,24 +140,51 @@ func (tFile *TheFile) GetBytes(byteFrom, byteTo int) (fromToBytes []byte, fromTo
 	return fromToBytes, fromToHash, nil
 }
 
+// GetByteOfChunk reads the fixed size chunk of index chunk, returning it along with its hash.
+// An index below 0 or from GetChunkCount on fails with ErrChunkOutOfRange.
 func (tFile *TheFile) GetByteOfChunk(chunk int) (chunkBytes []byte, chunkHash string, err error) {
-	cStart := tFile.chunkSize * chunk
-	cEnd := cStart + tFile.chunkSize
-	if cEnd >= len(tFile.GetContent()) {
-		cEnd = len(tFile.GetContent())
+	if chunk < 0 || chunk >= tFile.GetChunkCount() {
+		return nil, "", &PathError{Path: tFile.FilePath, Kind: ErrChunkOutOfRange,
+			Err: fmt.Errorf("no chunk %d, the file has %d chunks", chunk, tFile.GetChunkCount())}
+	}
+	cStart := int64(tFile.chunkSize) * int64(chunk)
+	cEnd := cStart + int64(tFile.chunkSize)
+	if cEnd >= tFile.size {
+		cEnd = tFile.size
+	}
+	chunkBytes, err = tFile.readRange(cStart, cEnd)
+	if err != nil {
+		return nil, "", err
 	}
-	chunkBytes = tFile.GetContent()[cStart:cEnd]
 	h := md5.New()
 	h.Write(chunkBytes)
 	chunkHash = hex.EncodeToString(h.Sum(nil))
 	return chunkBytes, chunkHash, nil
 }
 
+// readRange reads the bytes from byteFrom up to byteTo, from memory when the content was loaded
+// and from the storage otherwise, eg. with a ranged GET on an object store.
+func (tFile *TheFile) readRange(byteFrom, byteTo int64) ([]byte, error) {
+	if tFile.content != nil {
+		if byteTo > int64(len(tFile.content)) {
+			// the content was loaded before the file shrank
+			return nil, &PathError{Path: tFile.FilePath, Kind: ErrRangeOutOfBounds,
+				Err: fmt.Errorf("no bytes %d to %d, the file has %d bytes", byteFrom, byteTo, len(tFile.content))}
+		}
+		return tFile.content[byteFrom:byteTo], nil
+	}
+	return storage.ReadRange(tFile.store, tFile.storeName, byteFrom, byteTo-byteFrom)
+}
+
 func (tFile *TheFile) GetChunkSize() (currentChunkSize int) {
 	return tFile.chunkSize
 }
 
+// SetChunkInfo sets the size of the fixed size chunks, DefaultChunkSize when newChunkSize is not positive
 func (tFile *TheFile) SetChunkInfo(newChunkSize int) {
+	if newChunkSize <= 0 {
+		newChunkSize = DefaultChunkSize
+	}
 	tFile.chunkSize = newChunkSize
 }
 
@@ -113,12 +195,13 @@ type TheDirectory struct {
 	directories []*TheDirectory
 	files       []*TheFile
 	lastUpdate  time.Time
+	logger      *log.Entry
 }
 
 func NewTheDirectory(path string) (*TheDirectory, error) {
-	_, err := os.ReadDir(path)
+	_, err := readDirPath(path)
 	if err != nil {
-		return nil, err
+		return nil, pathErrorOf(path, err)
 	}
 	lIdx := strings.LastIndex(path, string(os.PathSeparator))
 	if lIdx > 0 {
@@ -139,6 +222,19 @@ func NewTheDirectory(path string) (*TheDirectory, error) {
 	}, nil
 }
 
+// WithContext makes tDir, and the files and directories it lists, log with the request ID carried by ctx
+func (tDir *TheDirectory) WithContext(ctx context.Context) *TheDirectory {
+	tDir.logger = Logger(ctx)
+	return tDir
+}
+
+func (tDir *TheDirectory) log() *log.Entry {
+	if tDir.logger == nil {
+		return log.NewEntry(log.StandardLogger())
+	}
+	return tDir.logger
+}
+
 func (tDir *TheDirectory) ListAll() (allFiles []*TheFile, allDir []*TheDirectory, err error) {
 	allDir, err = tDir.ListDirectories()
 	if err != nil {
@@ -153,52 +249,59 @@ func (tDir *TheDirectory) ListAll() (allFiles []*TheFile, allDir []*TheDirectory
 
 func (tDir *TheDirectory) ListFiles() (allFiles []*TheFile, err error) {
 	if tDir.lastUpdate.Sub(time.Now()) > (5*time.Minute) || tDir.files == nil {
-		fmt.Println("loading files on ", tDir.DirPath)
+		tDir.log().Debugf("loading files on %s", tDir.DirPath)
+		start := time.Now()
 		allFiles = make([]*TheFile, 0)
-		entries, err := os.ReadDir(tDir.DirPath)
+		entries, err := readDirPath(tDir.DirPath)
 		if err != nil {
-			return nil, err
+			return nil, pathErrorOf(tDir.DirPath, err)
 		}
 		for _, e := range entries {
 			if !e.IsDir() {
 				fToOpen := fmt.Sprintf("%s%s%s", tDir.DirPath, string(os.PathSeparator), e.Name())
 				tf, err := NewTheFile(fToOpen)
 				if err != nil {
-					fmt.Println("got error for listing file ", e.Name(), ". got ", err.Error())
+					tDir.log().Warnf("can not list file %s of %s. got %s", e.Name(), tDir.DirPath, err.Error())
 				} else {
+					tf.logger = tDir.logger
 					allFiles = append(allFiles, tf)
 				}
 			}
 		}
 		tDir.files = allFiles
 		tDir.lastUpdate = time.Now()
+		observeSince(scanDuration, start, "listing")
 		return allFiles, nil
 	} else {
 		return tDir.files, nil
 	}
 }
 
+// ListDirectories lists the sub directories of tDir, along with the ZIP and TAR files that can be browsed as one
 func (tDir *TheDirectory) ListDirectories() (allDir []*TheDirectory, err error) {
 	if tDir.lastUpdate.Sub(time.Now()) > (5*time.Minute) || tDir.files == nil {
-		fmt.Println("loading dirs on ", tDir.DirPath)
+		tDir.log().Debugf("loading dirs on %s", tDir.DirPath)
+		start := time.Now()
 		allDir = make([]*TheDirectory, 0)
-		entries, err := os.ReadDir(tDir.DirPath)
+		entries, err := readDirPath(tDir.DirPath)
 		if err != nil {
-			return nil, err
+			return nil, pathErrorOf(tDir.DirPath, err)
 		}
 		for _, e := range entries {
-			if e.IsDir() {
+			if (e.IsDir() || storage.IsArchive(e.Name())) && e.Name() != TrashDirName {
 				fToOpen := fmt.Sprintf("%s%s%s", tDir.DirPath, string(os.PathSeparator), e.Name())
 				tf, err := NewTheDirectory(fToOpen)
 				if err != nil {
-					fmt.Println("got error for listing dir in ", e.Name(), ". got ", err.Error())
+					tDir.log().Warnf("can not list directory %s of %s. got %s", e.Name(), tDir.DirPath, err.Error())
 				} else {
+					tf.logger = tDir.logger
 					allDir = append(allDir, tf)
 				}
 			}
 		}
 		tDir.directories = allDir
 		tDir.lastUpdate = time.Now()
+		observeSince(scanDuration, start, "listing")
 		return allDir, nil
 	} else {
 		return tDir.directories, nil
@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
 func TestListingDirectory(t *testing.T) {
-	tDir, err := NewTheDirectory("C:\\Users\\ferdi\\Workspace\\Golang\\src\\github.com\\newm4n\\Adverter\\sample")
+	tDir, err := NewTheDirectory(filepath.Join("..", "..", "..", "sample"))
 	assert.NoError(t, err)
 	assert.NotNil(t, tDir)
 
@@ -60,3 +63,39 @@ func TestPathInfo(t *testing.T) {
 
 	assert.Equal(t, path, pi2.Path)
 }
+
+func TestChunkBounds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "intro.mp4")
+	assert.NoError(t, os.WriteFile(path, bytes.Repeat([]byte("x"), 2*DefaultChunkSize+10), 0644))
+	tFile, err := NewTheFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, tFile.GetChunkCount())
+
+	for _, content := range [][]byte{nil, tFile.GetContent()} {
+		tFile.content = content
+		chunk, _, err := tFile.GetByteOfChunk(2)
+		assert.NoError(t, err)
+		assert.Len(t, chunk, 10)
+		for _, chunkNo := range []int{-1, 3, 999} {
+			_, _, err = tFile.GetByteOfChunk(chunkNo)
+			assert.True(t, errors.Is(err, ErrChunkOutOfRange), chunkNo)
+		}
+		for _, byteRange := range [][2]int{{-1, 5}, {10, 5}, {5, 5}, {0, 2*DefaultChunkSize + 11}} {
+			_, _, err = tFile.GetBytes(byteRange[0], byteRange[1])
+			assert.True(t, errors.Is(err, ErrRangeOutOfBounds), byteRange)
+		}
+	}
+}
+
+func TestEmptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.txt")
+	assert.NoError(t, os.WriteFile(path, nil, 0644))
+	tFile, err := NewTheFile(path)
+	assert.NoError(t, err)
+
+	hash, err := tFile.GetHash()
+	assert.NoError(t, err)
+	assert.Equal(t, MD5OfBytes(nil), hash)
+	_, _, err = tFile.GetBytes(0, 0)
+	assert.True(t, errors.Is(err, ErrRangeOutOfBounds))
+}
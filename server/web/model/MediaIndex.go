@@ -0,0 +1,489 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TagFileSuffix is the suffix of sidecar files holding the tags of the file they accompany.
+	// eg. "intro.mp4.tags" holds the tags of "intro.mp4", one or more per line, separated by comma.
+	TagFileSuffix = ".tags"
+)
+
+var (
+	// Library is the media index of all configured roots. It stays nil until the server initialize it.
+	Library *MediaIndex
+)
+
+// IndexEntry is a single file known to the MediaIndex
+type IndexEntry struct {
+	Root    string
+	Name    string
+	Path    string
+	Ext     string
+	Size    int64
+	ModTime time.Time
+	Tags    []string
+}
+
+// SearchQuery holds the criteria for MediaIndex.Search. Zero valued criteria are ignored.
+type SearchQuery struct {
+	Text     string
+	PathPart string
+	Ext      []string
+	MinSize  int64
+	MaxSize  int64
+	From     time.Time
+	To       time.Time
+	Tags     []string
+	Offset   int
+	Limit    int
+}
+
+// MediaIndex is an in-process index of every file under a set of roots.
+// It is kept current by a periodic scanner and a file system watcher.
+type MediaIndex struct {
+	roots   []string
+	entries map[string]*IndexEntry
+	mutex   sync.RWMutex
+	watcher *fsnotify.Watcher
+	watched map[string]string
+	stop    chan bool
+}
+
+// NewMediaIndex creates an empty index over the specified roots. Call Scan to populate it.
+func NewMediaIndex(roots ...string) *MediaIndex {
+	cleaned := make([]string, 0, len(roots))
+	for _, r := range roots {
+		r = strings.TrimSpace(r)
+		if len(r) == 0 {
+			continue
+		}
+		if abs, err := filepath.Abs(r); err == nil {
+			r = abs
+		}
+		cleaned = append(cleaned, filepath.Clean(r))
+	}
+	return &MediaIndex{
+		roots:   cleaned,
+		entries: make(map[string]*IndexEntry),
+	}
+}
+
+// Roots returns the roots covered by this index
+func (idx *MediaIndex) Roots() []string {
+	return idx.roots
+}
+
+// Contains tells whether path is one of the roots or lies below one of them
+func (idx *MediaIndex) Contains(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	return len(idx.rootOf(abs)) > 0
+}
+
+// RootOf returns the root path lies in, or an empty string if it is outside of every root
+func (idx *MediaIndex) RootOf(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	return idx.rootOf(abs)
+}
+
+// IsRoot tells whether path is one of the roots
+func (idx *MediaIndex) IsRoot(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, root := range idx.roots {
+		if root == abs {
+			return true
+		}
+	}
+	return false
+}
+
+// Size returns the number of files in the index
+func (idx *MediaIndex) Size() int {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	return len(idx.entries)
+}
+
+// Scan walks all roots and rebuilds the index from scratch.
+func (idx *MediaIndex) Scan() error {
+	defer observeSince(scanDuration, time.Now(), "index")
+	entries := make(map[string]*IndexEntry)
+	for _, root := range idx.roots {
+		err := walkPath(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				log.Warnf("index scan can not read %s. got %s", path, err.Error())
+				if d != nil && d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() && d.Name() == TrashDirName {
+				return fs.SkipDir
+			}
+			if d.IsDir() || strings.HasSuffix(d.Name(), TagFileSuffix) {
+				return nil
+			}
+			entry, err := newIndexEntry(root, path)
+			if err != nil {
+				log.Warnf("index scan can not stat %s. got %s", path, err.Error())
+				return nil
+			}
+			entries[path] = entry
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	idx.mutex.Lock()
+	idx.entries = entries
+	idx.mutex.Unlock()
+	log.Debugf("media index scanned %d files on %d roots", len(entries), len(idx.roots))
+	return nil
+}
+
+// Update re-index a single path. A path that no longer exist is removed from the index,
+// a directory is walked and every file below it is indexed.
+func (idx *MediaIndex) Update(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	root := idx.rootOf(path)
+	if len(root) == 0 || strings.Contains(path, string(os.PathSeparator)+TrashDirName+string(os.PathSeparator)) {
+		return
+	}
+	if strings.HasSuffix(path, TagFileSuffix) {
+		idx.Update(strings.TrimSuffix(path, TagFileSuffix))
+		return
+	}
+	inf, err := StatPath(path)
+	if err != nil {
+		idx.Remove(path)
+		return
+	}
+	if inf.IsDir() {
+		_ = walkPath(path, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && d.IsDir() && d.Name() == TrashDirName {
+				return fs.SkipDir
+			}
+			if err == nil && !d.IsDir() && !strings.HasSuffix(d.Name(), TagFileSuffix) {
+				if entry, err := newIndexEntry(root, p); err == nil {
+					idx.mutex.Lock()
+					idx.entries[p] = entry
+					idx.mutex.Unlock()
+				}
+			}
+			return nil
+		})
+		return
+	}
+	entry, err := newIndexEntry(root, path)
+	if err != nil {
+		idx.Remove(path)
+		return
+	}
+	idx.mutex.Lock()
+	idx.entries[path] = entry
+	idx.mutex.Unlock()
+}
+
+// Remove drops a path and everything below it from the index
+func (idx *MediaIndex) Remove(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	prefix := path + string(os.PathSeparator)
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	for p := range idx.entries {
+		if p == path || strings.HasPrefix(p, prefix) {
+			delete(idx.entries, p)
+		}
+	}
+}
+
+// OnChange keeps the index current with a change made through the API. It is meant to be
+// registered with SubscribeChanges.
+func (idx *MediaIndex) OnChange(event *ChangeEvent) {
+	switch event.Op {
+	case ChangeRemoved:
+		idx.Remove(event.Path)
+	case ChangeMoved:
+		idx.Remove(event.OldPath)
+		idx.Update(event.Path)
+	default:
+		idx.Update(event.Path)
+	}
+}
+
+// Search returns the entries matching the query, sorted by path.
+// The second return value is the total number of matches before Offset and Limit are applied.
+func (idx *MediaIndex) Search(query *SearchQuery) ([]*IndexEntry, int) {
+	terms := strings.Fields(strings.ToLower(query.Text))
+	pathPart := strings.ToLower(query.PathPart)
+	exts := make(map[string]bool)
+	for _, e := range query.Ext {
+		e = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(e), "."))
+		if len(e) > 0 {
+			exts[e] = true
+		}
+	}
+
+	ret := make([]*IndexEntry, 0)
+	idx.mutex.RLock()
+	for _, entry := range idx.entries {
+		if matches(entry, query, terms, pathPart, exts) {
+			ret = append(ret, entry)
+		}
+	}
+	idx.mutex.RUnlock()
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Path < ret[j].Path
+	})
+	total := len(ret)
+	if query.Offset > 0 {
+		if query.Offset >= len(ret) {
+			return make([]*IndexEntry, 0), total
+		}
+		ret = ret[query.Offset:]
+	}
+	if query.Limit > 0 && query.Limit < len(ret) {
+		ret = ret[:query.Limit]
+	}
+	return ret, total
+}
+
+// StartScanner rescan all roots every interval until Stop is called.
+func (idx *MediaIndex) StartScanner(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	stop := idx.stopChannel()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := idx.Scan(); err != nil {
+					log.Errorf("media index rescan failed. got %s", err.Error())
+				}
+			}
+		}
+	}()
+}
+
+// StartWatcher watches every directory under the roots stored on the local disk and update the index
+// as files change. Roots on other storages are only kept current by the scanner.
+func (idx *MediaIndex) StartWatcher() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	idx.mutex.Lock()
+	idx.watcher = watcher
+	idx.mutex.Unlock()
+	idx.watched = make(map[string]string)
+	for _, root := range idx.roots {
+		if osRoot, ok := localPathOf(root); ok {
+			idx.watched[osRoot] = root
+			watchTree(watcher, osRoot)
+		}
+	}
+	stop := idx.stopChannel()
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Has(fsnotify.Create) {
+					if inf, err := os.Stat(event.Name); err == nil && inf.IsDir() {
+						watchTree(watcher, event.Name)
+					}
+				}
+				if path, ok := idx.watchedPathOf(event.Name); ok {
+					idx.Update(path)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warnf("media index watcher error. got %s", err.Error())
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop terminates the scanner and the watcher
+func (idx *MediaIndex) Stop() {
+	idx.mutex.Lock()
+	if idx.stop != nil {
+		close(idx.stop)
+		idx.stop = nil
+	}
+	watcher := idx.watcher
+	idx.watcher = nil
+	idx.mutex.Unlock()
+	if watcher != nil {
+		_ = watcher.Close()
+	}
+}
+
+func (idx *MediaIndex) stopChannel() chan bool {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	if idx.stop == nil {
+		idx.stop = make(chan bool)
+	}
+	return idx.stop
+}
+
+// watchTree adds every directory under dir to watcher. The watcher is passed along rather than read from
+// the index, which Stop clears while the watching goroutine may still be running.
+func watchTree(watcher *fsnotify.Watcher, dir string) {
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && d.Name() == TrashDirName {
+			return fs.SkipDir
+		}
+		if d.IsDir() {
+			if err := watcher.Add(path); err != nil {
+				log.Warnf("media index can not watch %s. got %s", path, err.Error())
+			}
+		}
+		return nil
+	})
+}
+
+// watchedPathOf maps a local disk path reported by the watcher back to a path of the API
+func (idx *MediaIndex) watchedPathOf(osPath string) (string, bool) {
+	for osRoot, root := range idx.watched {
+		if osPath == osRoot {
+			return root, true
+		}
+		if strings.HasPrefix(osPath, osRoot+string(os.PathSeparator)) {
+			return filepath.Join(root, osPath[len(osRoot)+1:]), true
+		}
+	}
+	return "", false
+}
+
+func (idx *MediaIndex) rootOf(path string) string {
+	for _, root := range idx.roots {
+		if path == root || strings.HasPrefix(path, root+string(os.PathSeparator)) {
+			return root
+		}
+	}
+	return ""
+}
+
+func newIndexEntry(root, path string) (*IndexEntry, error) {
+	inf, err := StatPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if inf.IsDir() {
+		return nil, fmt.Errorf("%s is not a file", path)
+	}
+	return &IndexEntry{
+		Root:    root,
+		Name:    inf.Name(),
+		Path:    path,
+		Ext:     strings.ToLower(strings.TrimPrefix(filepath.Ext(inf.Name()), ".")),
+		Size:    inf.Size(),
+		ModTime: inf.ModTime(),
+		Tags:    readTags(path + TagFileSuffix),
+	}, nil
+}
+
+func readTags(tagFile string) []string {
+	data, err := readPath(tagFile)
+	if err != nil {
+		return nil
+	}
+	tags := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		for _, t := range strings.Split(scanner.Text(), ",") {
+			t = strings.ToLower(strings.TrimSpace(t))
+			if len(t) > 0 {
+				tags = append(tags, t)
+			}
+		}
+	}
+	return tags
+}
+
+func matches(entry *IndexEntry, query *SearchQuery, terms []string, pathPart string, exts map[string]bool) bool {
+	if len(exts) > 0 && !exts[entry.Ext] {
+		return false
+	}
+	if query.MinSize > 0 && entry.Size < query.MinSize {
+		return false
+	}
+	if query.MaxSize > 0 && entry.Size > query.MaxSize {
+		return false
+	}
+	if !query.From.IsZero() && entry.ModTime.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && entry.ModTime.After(query.To) {
+		return false
+	}
+	lPath := strings.ToLower(entry.Path)
+	if len(pathPart) > 0 && !strings.Contains(lPath, pathPart) {
+		return false
+	}
+	for _, tag := range query.Tags {
+		if !hasTag(entry, strings.ToLower(strings.TrimSpace(tag))) {
+			return false
+		}
+	}
+	lName := strings.ToLower(entry.Name)
+	for _, term := range terms {
+		if !strings.Contains(lName, term) && !strings.Contains(lPath, term) && !hasTag(entry, term) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasTag(entry *IndexEntry, tag string) bool {
+	for _, t := range entry.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMediaIndexSearch(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "summer", "banner"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "summer", "intro.mp4"), make([]byte, 2000), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "summer", "banner", "sale.jpg"), make([]byte, 500), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "summer", "banner", "sale.jpg.tags"), []byte("Promo, Beach\nsummer"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "outro.MP4"), make([]byte, 100), 0644))
+
+	idx := NewMediaIndex(root)
+	assert.NoError(t, idx.Scan())
+	assert.Equal(t, 3, idx.Size())
+
+	found, total := idx.Search(&SearchQuery{Ext: []string{".mp4"}})
+	assert.Equal(t, 2, total)
+	assert.Len(t, found, 2)
+
+	found, _ = idx.Search(&SearchQuery{Text: "sale"})
+	assert.Len(t, found, 1)
+	assert.Equal(t, []string{"promo", "beach", "summer"}, found[0].Tags)
+
+	found, _ = idx.Search(&SearchQuery{Tags: []string{"PROMO"}})
+	assert.Len(t, found, 1)
+
+	found, _ = idx.Search(&SearchQuery{PathPart: "summer", MinSize: 1000})
+	assert.Len(t, found, 1)
+	assert.Equal(t, "intro.mp4", found[0].Name)
+
+	found, _ = idx.Search(&SearchQuery{From: time.Now().Add(time.Hour)})
+	assert.Len(t, found, 0)
+
+	found, total = idx.Search(&SearchQuery{Offset: 1, Limit: 1})
+	assert.Equal(t, 3, total)
+	assert.Len(t, found, 1)
+
+	assert.NoError(t, os.Remove(filepath.Join(root, "outro.MP4")))
+	idx.Update(filepath.Join(root, "outro.MP4"))
+	assert.Equal(t, 2, idx.Size())
+
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "new.png"), make([]byte, 10), 0644))
+	idx.Update(filepath.Join(root, "new.png"))
+	found, _ = idx.Search(&SearchQuery{Ext: []string{"png"}})
+	assert.Len(t, found, 1)
+
+	idx.Remove(filepath.Join(root, "summer"))
+	assert.Equal(t, 1, idx.Size())
+}
+
+func TestMediaIndexWatcherStop(t *testing.T) {
+	root := t.TempDir()
+	idx := NewMediaIndex(root)
+	assert.NoError(t, idx.Scan())
+	assert.NoError(t, idx.StartWatcher())
+
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "new.png"), make([]byte, 10), 0644))
+	assert.Eventually(t, func() bool { return idx.Size() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// directories keep being created, and watched, while the index stops
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			_ = os.MkdirAll(filepath.Join(root, "burst", string(rune('a'+i%26)), "deep"), 0755)
+		}
+	}()
+	time.Sleep(time.Millisecond)
+	idx.Stop()
+	<-done
+	idx.Stop()
+}
@@ -0,0 +1,29 @@
+package model
+
+import (
+	"github.com/newm4n/Adverter/server/metrics"
+	"time"
+)
+
+var (
+	cacheRequests = metrics.NewCounter("adverter_chunk_cache_requests_total",
+		"Lookups of the manifest, archive and chunk index caches, by result", "cache", "result")
+	hashDuration = metrics.NewHistogram("adverter_hash_duration_seconds",
+		"Time spent hashing whole files and making chunk manifests", metrics.DefBuckets, "kind")
+	scanDuration = metrics.NewHistogram("adverter_directory_scan_duration_seconds",
+		"Time spent scanning the media roots and listing directories", metrics.DefBuckets, "kind")
+)
+
+// cacheLookup counts a hit or a miss of a cache
+func cacheLookup(cache string, hit bool) {
+	if hit {
+		cacheRequests.Inc(cache, "hit")
+	} else {
+		cacheRequests.Inc(cache, "miss")
+	}
+}
+
+// observeSince records the time elapsed since start in a histogram
+func observeSince(histogram *metrics.Histogram, start time.Time, labelValues ...string) {
+	histogram.Observe(time.Since(start).Seconds(), labelValues...)
+}
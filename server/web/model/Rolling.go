@@ -0,0 +1,34 @@
+package model
+
+// Rolling is the rsync weak checksum of a window of bytes. Sliding the window by one byte
+// updates it in constant time, so a file can be searched for known chunks at every offset.
+type Rolling struct {
+	a, b uint32
+	size uint32
+}
+
+// NewRolling computes the checksum of window
+func NewRolling(window []byte) *Rolling {
+	r := &Rolling{size: uint32(len(window))}
+	for i, c := range window {
+		r.a += uint32(c)
+		r.b += uint32(len(window)-i) * uint32(c)
+	}
+	return r
+}
+
+// Sum returns the current checksum
+func (r *Rolling) Sum() uint32 {
+	return (r.a & 0xffff) | (r.b&0xffff)<<16
+}
+
+// Roll slides the window by one byte, dropping out and taking in
+func (r *Rolling) Roll(out, in byte) {
+	r.a += uint32(in) - uint32(out)
+	r.b += r.a - r.size*uint32(out)
+}
+
+// WeakChecksum returns the rolling checksum of data
+func WeakChecksum(data []byte) uint32 {
+	return NewRolling(data).Sum()
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestRolling(t *testing.T) {
+	data := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(data)
+	window := 512
+	r := NewRolling(data[:window])
+	for i := 1; i+window <= len(data); i++ {
+		r.Roll(data[i-1], data[i+window-1])
+		assert.Equal(t, WeakChecksum(data[i:i+window]), r.Sum())
+	}
+}
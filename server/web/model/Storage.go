@@ -0,0 +1,375 @@
+package model
+
+import (
+	"errors"
+	"github.com/newm4n/Adverter/server/storage"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Resolve maps a path of the API onto the storage holding it and the name of the path within
+	// that storage. By default every path is a path of the local disk, unless it is below a mount.
+	Resolve = ResolveMounted
+
+	localVolumes sync.Map
+	archives     sync.Map
+	mounts       = make(map[string]storage.Storage)
+	mountsMutex  sync.RWMutex
+)
+
+// Mount serves every path below the local path at from store, eg. to front an S3 bucket
+func Mount(at string, store storage.Storage) error {
+	abs, err := filepath.Abs(at)
+	if err != nil {
+		return err
+	}
+	mountsMutex.Lock()
+	defer mountsMutex.Unlock()
+	mounts[abs] = store
+	return nil
+}
+
+// Unmount removes the mount made at the local path at
+func Unmount(at string) {
+	abs, err := filepath.Abs(at)
+	if err != nil {
+		return
+	}
+	mountsMutex.Lock()
+	defer mountsMutex.Unlock()
+	delete(mounts, abs)
+}
+
+// MountPoints lists the paths storages are mounted at, sorted
+func MountPoints() []string {
+	mountsMutex.RLock()
+	defer mountsMutex.RUnlock()
+	points := make([]string, 0, len(mounts))
+	for m := range mounts {
+		points = append(points, m)
+	}
+	sort.Strings(points)
+	return points
+}
+
+// ResolveMounted resolves a path below a mount into the mounted storage, the deepest mount winning.
+// Any other path is resolved by ResolveLocal.
+func ResolveMounted(p string) (storage.Storage, string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, "", err
+	}
+	store, name, ok := mountOf(abs)
+	if !ok {
+		store, name, err = ResolveLocal(abs)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return intoArchive(store, name)
+}
+
+// ResolveNamespace only resolves paths below a mount. Mounted at "/<name>", the mounts then make
+// a virtual tree hiding where each of them is actually stored.
+func ResolveNamespace(p string) (storage.Storage, string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, "", err
+	}
+	store, name, ok := mountOf(abs)
+	if !ok {
+		return nil, "", &fs.PathError{Op: "resolve", Path: p, Err: fs.ErrNotExist}
+	}
+	return intoArchive(store, name)
+}
+
+// mountOf finds the deepest mount holding the absolute path abs
+func mountOf(abs string) (storage.Storage, string, bool) {
+	mountsMutex.RLock()
+	defer mountsMutex.RUnlock()
+	var store storage.Storage
+	at := ""
+	for m, s := range mounts {
+		if len(m) > len(at) && isBelow(abs, m) {
+			at, store = m, s
+		}
+	}
+	if store == nil {
+		return nil, "", false
+	}
+	rel, err := filepath.Rel(at, abs)
+	if err != nil {
+		return nil, "", false
+	}
+	return store, filepath.ToSlash(rel), true
+}
+
+// ResolveLocal resolves path as a local disk path, relative paths being relative to the working directory
+func ResolveLocal(p string) (storage.Storage, string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, "", err
+	}
+	volume := filepath.VolumeName(abs)
+	top := volume + string(os.PathSeparator)
+	name := filepath.ToSlash(strings.TrimPrefix(abs[len(volume):], string(os.PathSeparator)))
+	if len(name) == 0 {
+		name = "."
+	}
+	store, _ := localVolumes.LoadOrStore(top, storage.NewLocal(top))
+	return store.(storage.Storage), name, nil
+}
+
+// StorageResolver returns a resolver serving every path from store, eg. to run against an in-memory tree.
+// Paths are taken relative to the top of the store, whether they start with a separator or not.
+func StorageResolver(store storage.Storage) func(p string) (storage.Storage, string, error) {
+	return func(p string) (storage.Storage, string, error) {
+		name := path.Clean("/" + filepath.ToSlash(p))[1:]
+		if len(name) == 0 {
+			name = "."
+		}
+		return intoArchive(store, name)
+	}
+}
+
+type cachedArchive struct {
+	archive *storage.Archive
+	size    int64
+	modTime time.Time
+}
+
+// intoArchive resolves a name going through ZIP or TAR files of store into the archive holding it,
+// eg. "ads/bundle.zip/banner/index.html" into "banner/index.html" of the archive "ads/bundle.zip".
+// The name of an archive file itself is left as it is.
+func intoArchive(store storage.Storage, name string) (storage.Storage, string, error) {
+	segments := strings.Split(name, "/")
+	for i := 0; i < len(segments)-1; i++ {
+		if !storage.IsArchive(segments[i]) {
+			continue
+		}
+		archive, err := archiveOf(store, strings.Join(segments[:i+1], "/"))
+		if err != nil {
+			if errors.Is(err, fs.ErrInvalid) {
+				// a directory named like an archive
+				continue
+			}
+			return nil, "", err
+		}
+		return intoArchive(archive, strings.Join(segments[i+1:], "/"))
+	}
+	return store, name, nil
+}
+
+// archiveOf opens the archive file name of store, reusing the index made earlier while the file is unchanged
+func archiveOf(store storage.Storage, name string) (*storage.Archive, error) {
+	info, err := store.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fs.ErrInvalid
+	}
+	key := archiveKey{store: store, name: name}
+	if cached, ok := archives.Load(key); ok {
+		c := cached.(*cachedArchive)
+		if c.size == info.Size() && c.modTime.Equal(info.ModTime()) {
+			cacheLookup("archive", true)
+			return c.archive, nil
+		}
+	}
+	cacheLookup("archive", false)
+	archive, err := storage.OpenArchive(store, name)
+	if err != nil {
+		return nil, err
+	}
+	archives.Store(key, &cachedArchive{archive: archive, size: info.Size(), modTime: info.ModTime()})
+	return archive, nil
+}
+
+type archiveKey struct {
+	store storage.Storage
+	name  string
+}
+
+// resolveDir resolves a path to browse as a directory. An archive file is browsed as the top of the archive.
+func resolveDir(p string) (storage.Storage, string, error) {
+	store, name, err := Resolve(p)
+	if err != nil {
+		return nil, "", err
+	}
+	if !storage.IsArchive(name) {
+		return store, name, nil
+	}
+	archive, err := archiveOf(store, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrInvalid) {
+			return store, name, nil
+		}
+		return nil, "", err
+	}
+	return archive, ".", nil
+}
+
+// StatPath returns the file info of a path of the API
+func StatPath(p string) (fs.FileInfo, error) {
+	store, name, err := Resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	return store.Stat(name)
+}
+
+func readPath(p string) ([]byte, error) {
+	store, name, err := Resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(store, name)
+}
+
+func writePath(p string, data []byte) error {
+	store, name, err := Resolve(p)
+	if err != nil {
+		return err
+	}
+	return storage.WriteFile(store, name, data)
+}
+
+func readDirPath(p string) ([]fs.DirEntry, error) {
+	store, name, err := resolveDir(p)
+	if err != nil {
+		return nil, err
+	}
+	return store.ReadDir(name)
+}
+
+func mkdirPath(p string, perm fs.FileMode) error {
+	store, name, err := Resolve(p)
+	if err != nil {
+		return err
+	}
+	return store.Mkdir(name, perm)
+}
+
+func mkdirAllPath(p string, perm fs.FileMode) error {
+	store, name, err := Resolve(p)
+	if err != nil {
+		return err
+	}
+	return store.MkdirAll(name, perm)
+}
+
+func removeAllPath(p string) error {
+	store, name, err := Resolve(p)
+	if err != nil {
+		return err
+	}
+	return store.RemoveAll(name)
+}
+
+// renamePath moves oldPath to newPath. Paths on different storages are copied, then removed.
+func renamePath(oldPath, newPath string) error {
+	oldStore, oldName, err := Resolve(oldPath)
+	if err != nil {
+		return err
+	}
+	newStore, newName, err := Resolve(newPath)
+	if err != nil {
+		return err
+	}
+	if oldStore == newStore {
+		return oldStore.Rename(oldName, newName)
+	}
+	if err := storage.CopyTree(oldStore, oldName, newStore, newName); err != nil {
+		return err
+	}
+	return oldStore.RemoveAll(oldName)
+}
+
+func copyFilePath(srcPath, dstPath string) error {
+	srcStore, srcName, err := Resolve(srcPath)
+	if err != nil {
+		return err
+	}
+	dstStore, dstName, err := Resolve(dstPath)
+	if err != nil {
+		return err
+	}
+	return storage.CopyFile(srcStore, srcName, dstStore, dstName)
+}
+
+// walkPath walks the tree at root like filepath.WalkDir, calling fn with paths of the API
+func walkPath(root string, fn func(p string, d fs.DirEntry, err error) error) error {
+	store, name, err := Resolve(root)
+	if err != nil {
+		return err
+	}
+	return fs.WalkDir(store, name, func(n string, d fs.DirEntry, err error) error {
+		if n == name {
+			return fn(root, d, err)
+		}
+		rel := n
+		if name != "." {
+			rel = n[len(name)+1:]
+		}
+		return fn(filepath.Join(root, filepath.FromSlash(rel)), d, err)
+	})
+}
+
+// localPathOf returns the local disk path behind a path of the API, if it is stored on the local disk
+func localPathOf(p string) (string, bool) {
+	store, name, err := Resolve(p)
+	if err != nil {
+		return "", false
+	}
+	local, ok := store.(*storage.Local)
+	if !ok {
+		return "", false
+	}
+	osPath, err := local.OSPath(name)
+	if err != nil {
+		return "", false
+	}
+	return osPath, true
+}
+
+// landFile moves a local staging file into the path p of the API, atomically.
+func landFile(stagingFile, p string) error {
+	if osPath, ok := localPathOf(p); ok {
+		// staging files are private to the server, the landed file is not
+		if err := os.Chmod(stagingFile, 0644); err != nil {
+			return err
+		}
+		return MoveFile(stagingFile, osPath)
+	}
+	store, name, err := Resolve(p)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(stagingFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	w, err := store.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		_ = w.Abort()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(stagingFile)
+}
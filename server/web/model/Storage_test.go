@@ -0,0 +1,118 @@
+package model
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/newm4n/Adverter/server/storage"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"testing"
+)
+
+func TestInMemoryLibrary(t *testing.T) {
+	mem := storage.NewMemory()
+	Resolve = StorageResolver(mem)
+	defer func() { Resolve = ResolveMounted }()
+
+	assert.NoError(t, mem.MkdirAll("ads/summer", 0755))
+	assert.NoError(t, storage.WriteFile(mem, "ads/summer/intro.mp4", make([]byte, DefaultChunkSize+10)))
+	assert.NoError(t, storage.WriteFile(mem, "ads/banner.jpg", []byte("banner")))
+
+	tDir, err := NewTheDirectory("/ads")
+	assert.NoError(t, err)
+	files, err := tDir.ListFiles()
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "/ads/banner.jpg", files[0].FilePath)
+
+	tFile, err := NewTheFile("/ads/summer/intro.mp4")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, tFile.GetChunkCount())
+
+	moved, err := MovePath("/ads/banner.jpg", "/ads/summer", "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "/ads/summer/banner.jpg", moved)
+
+	item, err := TrashPath("/ads", "/ads/summer")
+	assert.NoError(t, err)
+	_, err = mem.Stat("ads/.trash/" + item.ID + "/summer/banner.jpg")
+	assert.NoError(t, err)
+
+	idx := NewMediaIndex("/ads")
+	assert.NoError(t, idx.Scan())
+	assert.Equal(t, 0, idx.Size())
+
+	assert.NoError(t, item.Restore())
+	assert.NoError(t, idx.Scan())
+	assert.Equal(t, 2, idx.Size())
+}
+
+func TestArchiveAsDirectory(t *testing.T) {
+	mem := storage.NewMemory()
+	Resolve = StorageResolver(mem)
+	defer func() { Resolve = ResolveMounted }()
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	w, err := zw.Create("banner/index.html")
+	assert.NoError(t, err)
+	_, err = w.Write(make([]byte, DefaultChunkSize+10))
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+	assert.NoError(t, mem.MkdirAll("ads", 0755))
+	assert.NoError(t, storage.WriteFile(mem, "ads/bundle.zip", buf.Bytes()))
+
+	tDir, err := NewTheDirectory("/ads")
+	assert.NoError(t, err)
+	dirs, err := tDir.ListDirectories()
+	assert.NoError(t, err)
+	assert.Len(t, dirs, 1)
+	assert.Equal(t, "/ads/bundle.zip", dirs[0].DirPath)
+
+	dirs, err = dirs[0].ListDirectories()
+	assert.NoError(t, err)
+	assert.Len(t, dirs, 1)
+	files, err := dirs[0].ListFiles()
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "/ads/bundle.zip/banner/index.html", files[0].FilePath)
+
+	assert.Equal(t, 2, files[0].GetChunkCount())
+	chunk, _, err := files[0].GetByteOfChunk(1)
+	assert.NoError(t, err)
+	assert.Len(t, chunk, 10)
+	_, err = files[0].GetHash()
+	assert.NoError(t, err)
+
+	zipFile, err := NewTheFile("/ads/bundle.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), zipFile.GetSize())
+}
+
+func TestNamedMounts(t *testing.T) {
+	campaigns, brand := storage.NewMemory(), storage.NewMemory()
+	assert.NoError(t, Mount("/campaigns", campaigns))
+	assert.NoError(t, Mount("/brand-assets", brand))
+	defer Unmount("/campaigns")
+	defer Unmount("/brand-assets")
+	Resolve = ResolveNamespace
+	defer func() { Resolve = ResolveMounted }()
+
+	assert.Equal(t, []string{"/brand-assets", "/campaigns"}, MountPoints())
+	assert.NoError(t, storage.WriteFile(campaigns, "intro.mp4", []byte("intro")))
+
+	tFile, err := NewTheFile("/campaigns/intro.mp4")
+	assert.NoError(t, err)
+	assert.Equal(t, "intro", string(tFile.GetContent()))
+
+	_, err = StatPath("/etc")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	moved, err := MovePath("/campaigns/intro.mp4", "/brand-assets", "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "/brand-assets/intro.mp4", moved)
+	_, err = campaigns.Stat("intro.mp4")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = brand.Stat("intro.mp4")
+	assert.NoError(t, err)
+}
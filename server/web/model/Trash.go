@@ -0,0 +1,246 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// TrashDirName is the name of the trash directory kept at the top of every media root
+	TrashDirName = ".trash"
+)
+
+// InTrash tells whether path is a trash directory or lies inside one
+func InTrash(path string) bool {
+	for _, part := range strings.Split(filepath.Clean(path), string(os.PathSeparator)) {
+		if part == TrashDirName {
+			return true
+		}
+	}
+	return false
+}
+
+// TrashItem is a file or directory moved into the trash of its root
+type TrashItem struct {
+	ID           string
+	Root         string
+	Name         string
+	OriginalPath string
+	IsDir        bool
+	DeletedAt    time.Time
+}
+
+// TrashPath moves the file or directory at path into the trash of root, remembering where it came from.
+func TrashPath(root, path string) (*TrashItem, error) {
+	if err := checkNotTrash(path); err != nil {
+		return nil, err
+	}
+	inf, err := StatPath(path)
+	if err != nil {
+		return nil, err
+	}
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	item := &TrashItem{
+		ID:           id,
+		Root:         root,
+		Name:         inf.Name(),
+		OriginalPath: path,
+		IsDir:        inf.IsDir(),
+		DeletedAt:    time.Now(),
+	}
+	if err := mkdirAllPath(item.holderPath(), 0700); err != nil {
+		return nil, err
+	}
+	if err := item.save(); err != nil {
+		_ = removeAllPath(item.holderPath())
+		return nil, err
+	}
+	if err := renamePath(path, item.contentPath()); err != nil {
+		_ = removeAllPath(item.holderPath())
+		_ = removeAllPath(item.metaPath())
+		return nil, err
+	}
+	PublishChange(ChangeRemoved, path, "", item.IsDir)
+	return item, nil
+}
+
+// GetTrashItem returns the item id from the trash of root
+func GetTrashItem(root, id string) (*TrashItem, error) {
+	if err := ValidateName(id); err != nil {
+		return nil, err
+	}
+	data, err := readPath(filepath.Join(root, TrashDirName, id+uploadMetaSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("trash item %s not found. got %w", id, ErrNotFound)
+	}
+	item := &TrashItem{}
+	if err := json.Unmarshal(data, item); err != nil {
+		return nil, err
+	}
+	item.Root = root
+	return item, nil
+}
+
+// ListTrash returns every item in the trash of root, most recently deleted first
+func ListTrash(root string) ([]*TrashItem, error) {
+	items := make([]*TrashItem, 0)
+	entries, err := readDirPath(filepath.Join(root, TrashDirName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), uploadMetaSuffix) {
+			continue
+		}
+		item, err := GetTrashItem(root, strings.TrimSuffix(e.Name(), uploadMetaSuffix))
+		if err != nil {
+			log.Warnf("can not read trash item %s. got %s", e.Name(), err.Error())
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+	return items, nil
+}
+
+// PurgeTrash permanently removes every item of the trash of root deleted more than retention ago.
+// It returns the number of items purged.
+func PurgeTrash(root string, retention time.Duration) (int, error) {
+	items, err := ListTrash(root)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, item := range items {
+		if time.Since(item.DeletedAt) < retention {
+			continue
+		}
+		if err := item.Purge(); err != nil {
+			log.Errorf("can not purge trash item %s of %s. got %s", item.ID, item.OriginalPath, err.Error())
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// Restore moves the item back to its original path. The original parent directory is recreated
+// if needed, but an existing file or directory at the original path is never replaced.
+func (item *TrashItem) Restore() error {
+	if _, err := StatPath(item.OriginalPath); err == nil {
+		return fmt.Errorf("%s already exist. got %w", item.OriginalPath, ErrExist)
+	}
+	if err := mkdirAllPath(filepath.Dir(item.OriginalPath), 0755); err != nil {
+		return err
+	}
+	if err := renamePath(item.contentPath(), item.OriginalPath); err != nil {
+		return err
+	}
+	_ = removeAllPath(item.holderPath())
+	_ = removeAllPath(item.metaPath())
+	PublishChange(ChangeCreated, item.OriginalPath, "", item.IsDir)
+	return nil
+}
+
+// Purge permanently removes the item from the trash
+func (item *TrashItem) Purge() error {
+	if err := removeAllPath(item.holderPath()); err != nil {
+		return err
+	}
+	return removeAllPath(item.metaPath())
+}
+
+// TrashPurger periodically purges the trash of a set of roots from items older than the retention.
+type TrashPurger struct {
+	roots     []string
+	retention time.Duration
+	stop      chan bool
+}
+
+// NewTrashPurger creates a purger of the trash of roots, keeping items for retention
+func NewTrashPurger(roots []string, retention time.Duration) *TrashPurger {
+	return &TrashPurger{
+		roots:     roots,
+		retention: retention,
+	}
+}
+
+// Purge purges every trash once
+func (purger *TrashPurger) Purge() {
+	for _, root := range purger.roots {
+		purged, err := PurgeTrash(root, purger.retention)
+		if err != nil {
+			log.Errorf("can not purge trash of %s. got %s", root, err.Error())
+			continue
+		}
+		if purged > 0 {
+			log.Infof("purged %d items from trash of %s", purged, root)
+		}
+	}
+}
+
+// Start purges every trash now and then every interval until Stop is called
+func (purger *TrashPurger) Start(interval time.Duration) {
+	if interval <= 0 || purger.stop != nil {
+		return
+	}
+	purger.stop = make(chan bool)
+	stop := purger.stop
+	go func() {
+		purger.Purge()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				purger.Purge()
+			}
+		}
+	}()
+}
+
+// Stop terminates the periodic purge
+func (purger *TrashPurger) Stop() {
+	if purger.stop != nil {
+		close(purger.stop)
+		purger.stop = nil
+	}
+}
+
+func (item *TrashItem) save() error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return writePath(item.metaPath(), data)
+}
+
+func (item *TrashItem) holderPath() string {
+	return filepath.Join(item.Root, TrashDirName, item.ID)
+}
+
+func (item *TrashItem) contentPath() string {
+	return filepath.Join(item.holderPath(), item.Name)
+}
+
+func (item *TrashItem) metaPath() string {
+	return filepath.Join(item.Root, TrashDirName, item.ID+uploadMetaSuffix)
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTrashRetention(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"old.mp4", "new.mp4"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(name), 0644))
+	}
+	old, err := TrashPath(root, filepath.Join(root, "old.mp4"))
+	assert.NoError(t, err)
+	old.DeletedAt = time.Now().Add(-48 * time.Hour)
+	assert.NoError(t, old.save())
+	_, err = TrashPath(root, filepath.Join(root, "new.mp4"))
+	assert.NoError(t, err)
+
+	items, err := ListTrash(root)
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "new.mp4", items[0].Name)
+
+	purged, err := PurgeTrash(root, 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	items, err = ListTrash(root)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, filepath.Join(root, "new.mp4"), items[0].OriginalPath)
+
+	_, err = GetTrashItem(root, old.ID)
+	assert.Error(t, err)
+	_, err = os.Stat(old.holderPath())
+	assert.True(t, os.IsNotExist(err))
+
+	items, err = ListTrash(t.TempDir())
+	assert.NoError(t, err)
+	assert.Len(t, items, 0)
+}
@@ -0,0 +1,366 @@
+package model
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// TusUploads manages the tus.io uploads. It stays nil until the server initialize it.
+	TusUploads *TusManager
+
+	// ErrTusChecksumMismatch is returned by TusUpload.Append when the received data does not match its checksum.
+	ErrTusChecksumMismatch = fmt.Errorf("checksum mismatch")
+	// ErrTusOffsetMismatch is returned by TusUpload.Append when the offset is not the current upload offset.
+	ErrTusOffsetMismatch = fmt.Errorf("offset mismatch")
+	// ErrTusLandFailed is returned by TusUpload.Append when the complete file can not be moved into its
+	// target directory. The upload is dropped, the client has to start a new one.
+	ErrTusLandFailed = fmt.Errorf("landing failed")
+)
+
+// TusChecksumAlgorithms lists the checksum algorithms accepted in Upload-Checksum, in the tus naming.
+var TusChecksumAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// TusUpload is a single upload of the tus.io resumable upload protocol. Data is appended
+// into a staging file and landed into its target directory when the last byte arrives.
+type TusUpload struct {
+	ID         string
+	DirPath    string
+	Name       string
+	Length     int64
+	Offset     int64
+	Metadata   map[string]string
+	Created    time.Time
+	LastUpdate time.Time
+
+	manager *TusManager
+	mutex   sync.Mutex
+}
+
+// TusManager keeps track of all tus uploads. Uploads are persisted in the staging directory
+// so they survive a server restart.
+type TusManager struct {
+	stagingDir string
+	expiry     time.Duration
+	uploads    map[string]*TusUpload
+	mutex      sync.Mutex
+}
+
+// NewTusManager creates a tus upload manager staging its files in stagingDir and
+// restores the uploads left there by a previous run.
+func NewTusManager(stagingDir string, expiry time.Duration) (*TusManager, error) {
+	if err := os.MkdirAll(stagingDir, 0700); err != nil {
+		return nil, err
+	}
+	tm := &TusManager{
+		stagingDir: stagingDir,
+		expiry:     expiry,
+		uploads:    make(map[string]*TusUpload),
+	}
+	entries, err := os.ReadDir(stagingDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), uploadMetaSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(stagingDir, e.Name()))
+		if err != nil {
+			log.Warnf("can not read tus upload %s. got %s", e.Name(), err.Error())
+			continue
+		}
+		upload := &TusUpload{}
+		if err := json.Unmarshal(data, upload); err != nil {
+			log.Warnf("can not restore tus upload %s. got %s", e.Name(), err.Error())
+			continue
+		}
+		upload.manager = tm
+		tm.uploads[upload.ID] = upload
+	}
+	tm.PurgeExpired()
+	return tm, nil
+}
+
+// Create starts a new upload of length bytes into the directory tDir
+func (tm *TusManager) Create(tDir *TheDirectory, name string, length int64, metadata map[string]string) (*TusUpload, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("invalid upload length %d. got %w", length, ErrInvalid)
+	}
+	target := filepath.Join(tDir.DirPath, name)
+	if err := checkNotTrash(target); err != nil {
+		return nil, err
+	}
+	if _, err := StatPath(target); err == nil {
+		return nil, fmt.Errorf("%s already exist. got %w", target, ErrExist)
+	}
+	tm.PurgeExpired()
+
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	upload := &TusUpload{
+		ID:         id,
+		DirPath:    tDir.DirPath,
+		Name:       name,
+		Length:     length,
+		Metadata:   metadata,
+		Created:    time.Now(),
+		LastUpdate: time.Now(),
+		manager:    tm,
+	}
+	part, err := os.OpenFile(upload.partPath(), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	part.Close()
+	if err := upload.save(); err != nil {
+		return nil, err
+	}
+	tm.mutex.Lock()
+	tm.uploads[id] = upload
+	tm.mutex.Unlock()
+	if length == 0 {
+		if err := upload.land(); err != nil {
+			return nil, err
+		}
+	}
+	return upload, nil
+}
+
+// Get returns the upload with the specified id
+func (tm *TusManager) Get(id string) (*TusUpload, error) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	upload, ok := tm.uploads[id]
+	if !ok {
+		return nil, fmt.Errorf("tus upload %s not found. got %w", id, ErrNotFound)
+	}
+	return upload, nil
+}
+
+// Terminate cancels the upload and removes its staging files
+func (tm *TusManager) Terminate(id string) error {
+	tm.mutex.Lock()
+	upload, ok := tm.uploads[id]
+	delete(tm.uploads, id)
+	tm.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("tus upload %s not found. got %w", id, ErrNotFound)
+	}
+	upload.removeStaging()
+	return nil
+}
+
+// PurgeExpired terminates every unfinished upload not updated within the expiry duration
+func (tm *TusManager) PurgeExpired() {
+	if tm.expiry <= 0 {
+		return
+	}
+	tm.mutex.Lock()
+	uploads := make([]*TusUpload, 0, len(tm.uploads))
+	for _, upload := range tm.uploads {
+		uploads = append(uploads, upload)
+	}
+	tm.mutex.Unlock()
+	// the upload lock is taken without the manager lock, Append takes them the other way around
+	expired := make([]*TusUpload, 0)
+	for _, upload := range uploads {
+		upload.mutex.Lock()
+		lastUpdate := upload.LastUpdate
+		upload.mutex.Unlock()
+		if time.Since(lastUpdate) > tm.expiry {
+			expired = append(expired, upload)
+		}
+	}
+	tm.mutex.Lock()
+	for _, upload := range expired {
+		delete(tm.uploads, upload.ID)
+	}
+	tm.mutex.Unlock()
+	for _, upload := range expired {
+		log.Infof("tus upload %s of %s expired", upload.ID, upload.Name)
+		upload.removeStaging()
+	}
+}
+
+// Append writes the data read from reader at offset, which must be the current upload offset.
+// When algorithm is not empty, the data is only kept if it matches checksum, otherwise whatever
+// was received before the reader failed is kept so the client can resume from there.
+// The file is landed into its target directory once the upload is complete.
+func (upload *TusUpload) Append(offset int64, reader io.Reader, algorithm string, checksum []byte) (int64, error) {
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+	if offset != upload.Offset {
+		return upload.Offset, ErrTusOffsetMismatch
+	}
+	var h hash.Hash
+	if len(algorithm) > 0 {
+		newHash, ok := TusChecksumAlgorithms[algorithm]
+		if !ok {
+			return upload.Offset, fmt.Errorf("unsupported checksum algorithm %s. got %w", algorithm, ErrInvalid)
+		}
+		h = newHash()
+	}
+
+	part, err := os.OpenFile(upload.partPath(), os.O_WRONLY, 0600)
+	if err != nil {
+		return upload.Offset, err
+	}
+	defer part.Close()
+	if _, err := part.Seek(upload.Offset, io.SeekStart); err != nil {
+		return upload.Offset, err
+	}
+	var writer io.Writer = part
+	if h != nil {
+		writer = io.MultiWriter(part, h)
+	}
+	// one extra byte is allowed so a body longer than the remaining length is detected.
+	written, copyErr := io.Copy(writer, io.LimitReader(reader, upload.Length-upload.Offset+1))
+	if written > upload.Length-upload.Offset {
+		_ = part.Truncate(upload.Offset)
+		return upload.Offset, fmt.Errorf("body exceeds upload length %d. got %w", upload.Length, ErrInvalid)
+	}
+	if h != nil && (copyErr != nil || string(h.Sum(nil)) != string(checksum)) {
+		_ = part.Truncate(upload.Offset)
+		if copyErr != nil {
+			return upload.Offset, copyErr
+		}
+		return upload.Offset, ErrTusChecksumMismatch
+	}
+	upload.Offset += written
+	upload.LastUpdate = time.Now()
+	if err := upload.save(); err != nil {
+		return upload.Offset, err
+	}
+	if copyErr != nil {
+		return upload.Offset, copyErr
+	}
+	if upload.Offset == upload.Length {
+		part.Close()
+		if err := upload.land(); err != nil {
+			// a complete upload can not take more data, keeping it would only leave it stuck
+			upload.manager.mutex.Lock()
+			delete(upload.manager.uploads, upload.ID)
+			upload.manager.mutex.Unlock()
+			upload.removeStaging()
+			log.Errorf("tus upload %s can not land into %s. got %s", upload.ID, upload.TargetPath(), err.Error())
+			return upload.Offset, fmt.Errorf("%w. got %w", ErrTusLandFailed, err)
+		}
+	}
+	return upload.Offset, nil
+}
+
+// CurrentOffset returns the number of bytes received so far
+func (upload *TusUpload) CurrentOffset() int64 {
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+	return upload.Offset
+}
+
+// TargetPath is the path the file will have once the upload is complete
+func (upload *TusUpload) TargetPath() string {
+	return filepath.Join(upload.DirPath, upload.Name)
+}
+
+// EncodedMetadata returns the metadata in the Upload-Metadata header format
+func (upload *TusUpload) EncodedMetadata() string {
+	keys := make([]string, 0, len(upload.Metadata))
+	for k := range upload.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if len(upload.Metadata[k]) == 0 {
+			pairs = append(pairs, k)
+		} else {
+			pairs = append(pairs, fmt.Sprintf("%s %s", k, base64.StdEncoding.EncodeToString([]byte(upload.Metadata[k]))))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+// ParseTusMetadata decodes an Upload-Metadata header into its key value pairs
+func ParseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if len(strings.TrimSpace(header)) == 0 {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		kv := strings.Fields(pair)
+		switch len(kv) {
+		case 1:
+			metadata[kv[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(kv[1])
+			if err != nil {
+				return nil, fmt.Errorf("metadata %s is not base64 encoded. got %w", kv[0], ErrInvalid)
+			}
+			metadata[kv[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("malformed metadata %q. got %w", pair, ErrInvalid)
+		}
+	}
+	return metadata, nil
+}
+
+func (upload *TusUpload) land() error {
+	target := upload.TargetPath()
+	if _, err := StatPath(target); err == nil {
+		return fmt.Errorf("%s already exist. got %w", target, ErrExist)
+	}
+	if err := landFile(upload.partPath(), target); err != nil {
+		return err
+	}
+	_ = os.Remove(upload.metaPath())
+	PublishChange(ChangeCreated, target, "", false)
+	log.Infof("tus upload %s landed into %s", upload.ID, target)
+	return nil
+}
+
+func (upload *TusUpload) save() error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	tmp := upload.metaPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, upload.metaPath())
+}
+
+func (upload *TusUpload) removeStaging() {
+	_ = os.Remove(upload.partPath())
+	_ = os.Remove(upload.metaPath())
+}
+
+func (upload *TusUpload) partPath() string {
+	return filepath.Join(upload.manager.stagingDir, upload.ID+uploadPartSuffix)
+}
+
+func (upload *TusUpload) metaPath() string {
+	return filepath.Join(upload.manager.stagingDir, upload.ID+uploadMetaSuffix)
+}
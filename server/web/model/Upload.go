@@ -0,0 +1,429 @@
+package model
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	uploadMetaSuffix = ".json"
+	uploadPartSuffix = ".part"
+)
+
+var (
+	// Uploads manages the resumable upload sessions. It stays nil until the server initialize it.
+	Uploads *UploadManager
+)
+
+// UploadSession is a resumable upload of a single file, received chunk by chunk
+// into a staging file and moved into its target directory once complete.
+type UploadSession struct {
+	ID         string
+	DirPath    string
+	Name       string
+	Size       int64
+	ChunkSize  int
+	ChunkCount int
+	FileHash   string
+	Overwrite  bool
+	Received   map[int]string
+	Created    time.Time
+	LastUpdate time.Time
+
+	manager *UploadManager
+	mutex   sync.Mutex
+}
+
+// MaxUploadChunks bounds the chunk count of an upload session, which is walked whenever its missing
+// chunks are listed
+const MaxUploadChunks = 1 << 20
+
+// UploadManager keeps track of all upload sessions and their staging files.
+// Sessions are persisted in the staging directory so they survive a server restart.
+type UploadManager struct {
+	// MaxSize is the largest file, in bytes, a session may be initiated for. 0 means unlimited.
+	MaxSize int64
+
+	stagingDir string
+	expiry     time.Duration
+	sessions   map[string]*UploadSession
+	mutex      sync.Mutex
+}
+
+// NewUploadManager creates an upload manager staging its files in stagingDir and
+// restores the sessions left there by a previous run.
+func NewUploadManager(stagingDir string, expiry time.Duration) (*UploadManager, error) {
+	if err := os.MkdirAll(stagingDir, 0700); err != nil {
+		return nil, err
+	}
+	um := &UploadManager{
+		stagingDir: stagingDir,
+		expiry:     expiry,
+		sessions:   make(map[string]*UploadSession),
+	}
+	entries, err := os.ReadDir(stagingDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), uploadMetaSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(stagingDir, e.Name()))
+		if err != nil {
+			log.Warnf("can not read upload session %s. got %s", e.Name(), err.Error())
+			continue
+		}
+		session := &UploadSession{}
+		if err := json.Unmarshal(data, session); err != nil {
+			log.Warnf("can not restore upload session %s. got %s", e.Name(), err.Error())
+			continue
+		}
+		session.manager = um
+		if session.Received == nil {
+			session.Received = make(map[int]string)
+		}
+		um.sessions[session.ID] = session
+	}
+	um.PurgeExpired()
+	return um, nil
+}
+
+// Initiate starts a new upload session of a file named name, size bytes long, into the directory tDir.
+func (um *UploadManager) Initiate(tDir *TheDirectory, name string, size int64, chunkSize int, fileHash string, overwrite bool) (*UploadSession, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("can not upload empty file. got %w", ErrInvalid)
+	}
+	if um.MaxSize > 0 && size > um.MaxSize {
+		return nil, fmt.Errorf("upload of %d bytes above the maximum of %d. got %w", size, um.MaxSize, ErrTooLarge)
+	}
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	chunks := size / int64(chunkSize)
+	if size%int64(chunkSize) != 0 {
+		chunks++
+	}
+	if chunks > MaxUploadChunks {
+		return nil, fmt.Errorf("chunk size %d makes %d chunks, above the maximum of %d. got %w",
+			chunkSize, chunks, MaxUploadChunks, ErrInvalid)
+	}
+	chunkCount := int(chunks)
+	target := filepath.Join(tDir.DirPath, name)
+	// a file in place of the trash directory would break every later delete under the root
+	if err := checkNotTrash(target); err != nil {
+		return nil, err
+	}
+	if !overwrite {
+		if _, err := StatPath(target); err == nil {
+			return nil, fmt.Errorf("%s already exist. got %w", target, ErrExist)
+		}
+	}
+	um.PurgeExpired()
+
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	session := &UploadSession{
+		ID:         id,
+		DirPath:    tDir.DirPath,
+		Name:       name,
+		Size:       size,
+		ChunkSize:  chunkSize,
+		ChunkCount: chunkCount,
+		FileHash:   strings.ToLower(fileHash),
+		Overwrite:  overwrite,
+		Received:   make(map[int]string),
+		Created:    time.Now(),
+		LastUpdate: time.Now(),
+		manager:    um,
+	}
+	part, err := os.OpenFile(session.partPath(), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = part.Truncate(size)
+	part.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := session.save(); err != nil {
+		return nil, err
+	}
+	um.mutex.Lock()
+	um.sessions[id] = session
+	um.mutex.Unlock()
+	return session, nil
+}
+
+// Get returns the session with the specified id
+func (um *UploadManager) Get(id string) (*UploadSession, error) {
+	um.mutex.Lock()
+	defer um.mutex.Unlock()
+	session, ok := um.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("upload session %s not found. got %w", id, ErrNotFound)
+	}
+	return session, nil
+}
+
+// Abort cancels the session and removes its staging files
+func (um *UploadManager) Abort(id string) error {
+	um.mutex.Lock()
+	session, ok := um.sessions[id]
+	delete(um.sessions, id)
+	um.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("upload session %s not found. got %w", id, ErrNotFound)
+	}
+	session.removeStaging()
+	return nil
+}
+
+// PurgeExpired aborts every session not updated within the expiry duration
+func (um *UploadManager) PurgeExpired() {
+	if um.expiry <= 0 {
+		return
+	}
+	um.mutex.Lock()
+	sessions := make([]*UploadSession, 0, len(um.sessions))
+	for _, session := range um.sessions {
+		sessions = append(sessions, session)
+	}
+	um.mutex.Unlock()
+	// the session lock is taken without the manager lock, Finalize takes them the other way around
+	expired := make([]*UploadSession, 0)
+	for _, session := range sessions {
+		session.mutex.Lock()
+		lastUpdate := session.LastUpdate
+		session.mutex.Unlock()
+		if time.Since(lastUpdate) > um.expiry {
+			expired = append(expired, session)
+		}
+	}
+	um.mutex.Lock()
+	for _, session := range expired {
+		delete(um.sessions, session.ID)
+	}
+	um.mutex.Unlock()
+	for _, session := range expired {
+		log.Infof("upload session %s of %s expired", session.ID, session.Name)
+		session.removeStaging()
+	}
+}
+
+// Finalize verifies the whole file hash of a complete session and moves the file into its target directory.
+// fileHash may be empty if it was given when the session was initiated.
+func (um *UploadManager) Finalize(id, fileHash string) (*TheFile, error) {
+	session, err := um.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if missing := session.missingChunks(); len(missing) > 0 {
+		return nil, fmt.Errorf("upload incomplete. %d chunks missing. got %w", len(missing), ErrInvalid)
+	}
+	expected := strings.ToLower(fileHash)
+	if len(expected) == 0 {
+		expected = session.FileHash
+	}
+	if len(expected) == 0 {
+		return nil, fmt.Errorf("file hash is required. got %w", ErrInvalid)
+	}
+	actual, err := md5OfFile(session.partPath())
+	if err != nil {
+		return nil, err
+	}
+	if actual != expected {
+		return nil, fmt.Errorf("%w file hash. expect %s got %s", ErrInvalid, expected, actual)
+	}
+
+	target := session.TargetPath()
+	if !session.Overwrite {
+		if _, err := StatPath(target); err == nil {
+			return nil, fmt.Errorf("%s already exist. got %w", target, ErrExist)
+		}
+	}
+	if err := landFile(session.partPath(), target); err != nil {
+		return nil, err
+	}
+	um.mutex.Lock()
+	delete(um.sessions, id)
+	um.mutex.Unlock()
+	_ = os.Remove(session.metaPath())
+	PublishChange(ChangeCreated, target, "", false)
+	return NewTheFile(target)
+}
+
+// PutChunk stores chunk number chunkNo after verifying its MD5 hash
+func (session *UploadSession) PutChunk(chunkNo int, data []byte, hash string) error {
+	if chunkNo < 0 || chunkNo >= session.ChunkCount {
+		return fmt.Errorf("chunk %d out of range 0 to %d. got %w", chunkNo, session.ChunkCount-1, ErrChunkOutOfRange)
+	}
+	expectedLen := session.ChunkSize
+	if chunkNo == session.ChunkCount-1 {
+		expectedLen = int(session.Size - int64(chunkNo)*int64(session.ChunkSize))
+	}
+	if len(data) != expectedLen {
+		return fmt.Errorf("%w chunk %d. expect %d bytes got %d", ErrInvalid, chunkNo, expectedLen, len(data))
+	}
+	actual := MD5OfBytes(data)
+	if actual != strings.ToLower(hash) {
+		return fmt.Errorf("%w hash of chunk %d. expect %s got %s", ErrInvalid, chunkNo, hash, actual)
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	part, err := os.OpenFile(session.partPath(), os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = part.WriteAt(data, int64(chunkNo)*int64(session.ChunkSize))
+	if cerr := part.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	session.Received[chunkNo] = actual
+	session.LastUpdate = time.Now()
+	return session.save()
+}
+
+// MissingChunks returns the chunk numbers not received yet, in ascending order
+func (session *UploadSession) MissingChunks() []int {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	return session.missingChunks()
+}
+
+// TargetPath is the path the file will have once the upload is finalized
+func (session *UploadSession) TargetPath() string {
+	return filepath.Join(session.DirPath, session.Name)
+}
+
+func (session *UploadSession) missingChunks() []int {
+	missing := make([]int, 0)
+	for i := 0; i < session.ChunkCount; i++ {
+		if _, ok := session.Received[i]; !ok {
+			missing = append(missing, i)
+		}
+	}
+	sort.Ints(missing)
+	return missing
+}
+
+func (session *UploadSession) save() error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	tmp := session.metaPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, session.metaPath())
+}
+
+func (session *UploadSession) removeStaging() {
+	_ = os.Remove(session.partPath())
+	_ = os.Remove(session.metaPath())
+}
+
+func (session *UploadSession) partPath() string {
+	return filepath.Join(session.manager.stagingDir, session.ID+uploadPartSuffix)
+}
+
+func (session *UploadSession) metaPath() string {
+	return filepath.Join(session.manager.stagingDir, session.ID+uploadMetaSuffix)
+}
+
+// ValidateName makes sure name is a plain file or directory name that can not escape its parent
+func ValidateName(name string) error {
+	if len(name) == 0 || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return fmt.Errorf("invalid name %q. got %w", name, ErrInvalid)
+	}
+	return nil
+}
+
+// MoveFile atomically moves a file from src into dst. When both are not on the same device,
+// the file is copied next to dst first and then renamed, so dst never appears half written.
+func MoveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.CreateTemp(filepath.Dir(dst), ".adverter-*")
+	if err != nil {
+		return err
+	}
+	tmp := out.Name()
+	// keep the mode src had, as a rename would
+	err = out.Chmod(info.Mode().Perm())
+	if err == nil {
+		_, err = io.Copy(out, in)
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+func md5OfFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
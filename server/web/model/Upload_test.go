@@ -0,0 +1,107 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUploadSession(t *testing.T) {
+	target := t.TempDir()
+	staging := t.TempDir()
+	tDir, err := NewTheDirectory(target)
+	assert.NoError(t, err)
+
+	content := make([]byte, 2500)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	um, err := NewUploadManager(staging, time.Hour)
+	assert.NoError(t, err)
+	session, err := um.Initiate(tDir, "creative.bin", int64(len(content)), 1000, "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, session.ChunkCount)
+	assert.Equal(t, []int{0, 1, 2}, session.MissingChunks())
+
+	assert.Error(t, session.PutChunk(0, content[:1000], "bogus"))
+	assert.Error(t, session.PutChunk(3, content[:500], MD5OfBytes(content[:500])))
+	assert.NoError(t, session.PutChunk(2, content[2000:], MD5OfBytes(content[2000:])))
+	assert.NoError(t, session.PutChunk(0, content[:1000], MD5OfBytes(content[:1000])))
+	assert.Equal(t, []int{1}, session.MissingChunks())
+
+	_, err = um.Finalize(session.ID, MD5OfBytes(content))
+	assert.Error(t, err)
+
+	// the session survives a restart of the manager
+	um, err = NewUploadManager(staging, time.Hour)
+	assert.NoError(t, err)
+	session, err = um.Get(session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, session.MissingChunks())
+	assert.NoError(t, session.PutChunk(1, content[1000:2000], MD5OfBytes(content[1000:2000])))
+
+	_, err = um.Finalize(session.ID, "0123456789abcdef0123456789abcdef")
+	assert.Error(t, err)
+	tFile, err := um.Finalize(session.ID, MD5OfBytes(content))
+	assert.NoError(t, err)
+	assert.Equal(t, content, tFile.GetContent())
+
+	_, err = um.Get(session.ID)
+	assert.Error(t, err)
+	left, err := os.ReadDir(staging)
+	assert.NoError(t, err)
+	assert.Len(t, left, 0)
+
+	_, err = um.Initiate(tDir, "creative.bin", 10, 0, "", false)
+	assert.Error(t, err)
+	_, err = um.Initiate(tDir, filepath.Join("..", "escape.bin"), 10, 0, "", false)
+	assert.Error(t, err)
+}
+
+func TestUploadPurgeWhileUploading(t *testing.T) {
+	tDir, err := NewTheDirectory(t.TempDir())
+	assert.NoError(t, err)
+	um, err := NewUploadManager(t.TempDir(), time.Hour)
+	assert.NoError(t, err)
+	content := make([]byte, 1000)
+	session, err := um.Initiate(tDir, "creative.bin", int64(len(content)), 100, MD5OfBytes(content), false)
+	assert.NoError(t, err)
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			um.PurgeExpired()
+		}
+	}()
+	for chunkNo := 0; chunkNo < 10; chunkNo++ {
+		assert.NoError(t, session.PutChunk(chunkNo, content[:100], MD5OfBytes(content[:100])))
+	}
+	_, err = um.Finalize(session.ID, "")
+	assert.NoError(t, err)
+	<-done
+}
+
+func TestUploadLimits(t *testing.T) {
+	tDir, err := NewTheDirectory(t.TempDir())
+	assert.NoError(t, err)
+	um, err := NewUploadManager(t.TempDir(), time.Hour)
+	assert.NoError(t, err)
+	um.MaxSize = 1 << 20
+
+	_, err = um.Initiate(tDir, "huge.bin", 1<<40, 1<<20, "", false)
+	assert.ErrorIs(t, err, ErrTooLarge)
+	_, err = um.Initiate(tDir, "tiny-chunks.bin", 1<<20, 0, "", false)
+	assert.NoError(t, err)
+
+	// without a size limit, the chunk count still bounds the session
+	um.MaxSize = 0
+	_, err = um.Initiate(tDir, "tiny-chunks.bin", 1<<40, 1, "", true)
+	assert.ErrorIs(t, err, ErrInvalid)
+	session, err := um.Initiate(tDir, "many-chunks.bin", MaxUploadChunks, 1, "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, MaxUploadChunks, session.ChunkCount)
+}